@@ -1,8 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/creachadair/command"
@@ -18,7 +22,14 @@ var cmdList = &command.C{
 	Help: `List the keys of key-value mappings.
 
 With no keys, all the key-value mappings defined in the file are listed.
-Otherwise, only those mappings having the given prefix are listed.`,
+Otherwise, only those mappings having the given prefix are listed.
+With -values, each mapping is listed with its value, and each table
+is listed as its heading.`,
+
+	SetFlags: func(env *command.Env, fs *flag.FlagSet) {
+		cfg := env.Config.(*settings)
+		fs.BoolVar(&cfg.Values, "values", false, "List the values of mappings")
+	},
 
 	Run: func(env *command.Env) error {
 		doc, err := env.Config.(*settings).loadDocument()
@@ -29,9 +40,16 @@ Otherwise, only those mappings having the given prefix are listed.`,
 		if err != nil {
 			return err
 		}
-		doc.Scan(func(key parser.Key, _ *tomledit.Entry) bool {
-			if hasPrefixIn(key, keys) {
+		values := env.Config.(*settings).Values
+		doc.Scan(func(key parser.Key, e *tomledit.Entry) bool {
+			if !hasPrefixIn(key, keys) {
+				return true
+			} else if !values {
 				fmt.Println(key)
+			} else if e.IsSection() {
+				fmt.Println(e.Section.Heading.String())
+			} else {
+				fmt.Printf("%s = %s\n", key, e.KeyValue.Value.X)
 			}
 			return true
 		})
@@ -68,6 +86,59 @@ var cmdPrint = &command.C{
 	},
 }
 
+var cmdGet = &command.C{
+	Name:  "get",
+	Usage: "<key>",
+	Help: `Print the decoded value of the first definition of a key.
+
+By default, a string value is printed without quotes or escapes, and other
+values are printed in TOML syntax. With -type, the value must have the given
+type (string, int, float, or bool) and is printed in plain form.
+
+If the key is not found, get reports an error, unless -default is set,
+in which case the default text is printed instead.`,
+
+	SetFlags: func(env *command.Env, fs *flag.FlagSet) {
+		cfg := env.Config.(*settings)
+		fs.StringVar(&cfg.Type, "type", "", "Required value type (string, int, float, bool)")
+		fs.Func("default", "Text to print if the key is not found", func(s string) error {
+			cfg.Default = &s
+			return nil
+		})
+	},
+
+	Run: func(env *command.Env) error {
+		if len(env.Args) != 1 {
+			return env.Usagef("required argument is <key>")
+		}
+		key, err := parser.ParseKey(env.Args[0])
+		if err != nil {
+			return fmt.Errorf("parsing key: %w", err)
+		}
+		cfg := env.Config.(*settings)
+		doc, err := cfg.loadDocument()
+		if err != nil {
+			return err
+		}
+		first := doc.First(key...)
+		if first == nil {
+			if cfg.Default != nil {
+				fmt.Println(*cfg.Default)
+				return nil
+			}
+			return fmt.Errorf("key %q not found", key)
+		} else if !first.IsMapping() {
+			return fmt.Errorf("%q is not a key-value mapping", key)
+		}
+		text, err := formatValue(first.Value, cfg.Type)
+		if err != nil {
+			return fmt.Errorf("value of %q: %w", key, err)
+		}
+		fmt.Println(text)
+		return nil
+	},
+}
+
 var cmdSet = &command.C{
 	Name:  "set",
 	Usage: "<key> <value>",
@@ -90,15 +161,9 @@ var cmdSet = &command.C{
 		if err != nil {
 			return err
 		}
-		found := doc.Find(key...)
-		if len(found) == 0 {
-			return fmt.Errorf("key %q not found", key)
-		} else if len(found) > 1 {
-			return fmt.Errorf("found %d definitions of key %q", len(found), key)
-		} else if !found[0].IsMapping() {
-			return fmt.Errorf("%q is not a key-value mapping", key)
+		if err := doc.Set(key, val); err != nil {
+			return err
 		}
-		found[0].KeyValue.Value = val
 		return cfg.saveDocument(doc)
 	},
 }
@@ -164,6 +229,270 @@ An error is reported if the key already exists, unless -replace is set.`,
 	},
 }
 
+var cmdDelete = &command.C{
+	Name:  "delete",
+	Usage: "<key>",
+	Help: `Delete a key-value mapping or a table.
+
+By default, only the first definition of the key is deleted.
+With -all, every definition is deleted, such as each element of an array table.
+Deleting a table removes its section, including all the mappings it contains.
+An error is reported if the key is not found.`,
+
+	SetFlags: func(env *command.Env, fs *flag.FlagSet) {
+		cfg := env.Config.(*settings)
+		fs.BoolVar(&cfg.All, "all", false, "Delete all definitions of the key")
+	},
+
+	Run: func(env *command.Env) error {
+		if len(env.Args) != 1 {
+			return env.Usagef("required argument is <key>")
+		}
+		key, err := parser.ParseKey(env.Args[0])
+		if err != nil {
+			return fmt.Errorf("parsing key: %w", err)
+		}
+		cfg := env.Config.(*settings)
+		doc, err := cfg.loadDocument()
+		if err != nil {
+			return err
+		}
+		if cfg.All {
+			if doc.DeleteAll(key) == 0 {
+				return fmt.Errorf("key %q not found", key)
+			}
+		} else if !doc.Delete(key) {
+			return fmt.Errorf("key %q not found", key)
+		}
+		return cfg.saveDocument(doc)
+	},
+}
+
+var cmdRename = &command.C{
+	Name:  "rename",
+	Usage: "<old-key> <new-key>",
+	Help: `Rename the first definition of a key-value mapping or a table.
+
+The entry is not moved within the file, only its label is changed.
+For a table, the new key is the complete name of the table.
+For a mapping, the new key replaces the key as written in its table,
+so to rename x in the mapping t.x defined in [t], the new key is y.`,
+
+	Run: func(env *command.Env) error {
+		if len(env.Args) != 2 {
+			return env.Usagef("required arguments are <old-key> <new-key>")
+		}
+		keys, err := parseKeys(env.Args)
+		if err != nil {
+			return err
+		}
+		cfg := env.Config.(*settings)
+		doc, err := cfg.loadDocument()
+		if err != nil {
+			return err
+		}
+		if err := transform.Rename(keys[0], keys[1]).Apply(env.Context(), doc); err != nil {
+			return err
+		}
+		return cfg.saveDocument(doc)
+	},
+}
+
+var cmdMove = &command.C{
+	Name:  "move",
+	Usage: "<old-key> <root-key> <new-key>",
+	Help: `Move a key-value mapping to a different table.
+
+The first mapping for old-key is removed from its current location and
+added to the end of the table named by root-key, with the name new-key.
+The root-key must name a table section or an inline table.`,
+
+	Run: func(env *command.Env) error {
+		if len(env.Args) != 3 {
+			return env.Usagef("required arguments are <old-key> <root-key> <new-key>")
+		}
+		keys, err := parseKeys(env.Args)
+		if err != nil {
+			return err
+		}
+		cfg := env.Config.(*settings)
+		doc, err := cfg.loadDocument()
+		if err != nil {
+			return err
+		}
+		if err := transform.MoveKey(keys[0], keys[1], keys[2]).Apply(env.Context(), doc); err != nil {
+			return err
+		}
+		return cfg.saveDocument(doc)
+	},
+}
+
+var cmdFormat = &command.C{
+	Name: "fmt",
+	Help: `Reformat the file in canonical form.
+
+The file is rewritten only if its formatting changes.
+With -check, the file is not modified, and an error is reported
+if it is not already formatted.`,
+
+	SetFlags: func(env *command.Env, fs *flag.FlagSet) {
+		cfg := env.Config.(*settings)
+		fs.BoolVar(&cfg.Check, "check", false, "Report an error if the file is not formatted")
+		fs.StringVar(&cfg.Format.Indent, "indent", "", "Indentation unit (default two spaces)")
+		fs.BoolVar(&cfg.Format.IndentTables, "indent-tables", false, "Indent the contents of tables")
+		fs.BoolVar(&cfg.Format.AlignValues, "align", false, "Align the values of adjacent mappings")
+		fs.IntVar(&cfg.Format.MaxLineWidth, "width", 0, "Wrap arrays on lines longer than this (0 means no limit)")
+	},
+
+	Run: func(env *command.Env) error {
+		if len(env.Args) != 0 {
+			return env.Usagef("extra arguments after command")
+		}
+		cfg := env.Config.(*settings)
+		data, err := cfg.readInput()
+		if err != nil {
+			return err
+		}
+		doc, err := tomledit.Parse(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := cfg.Format.Format(&buf, doc); err != nil {
+			return fmt.Errorf("formatting output: %w", err)
+		}
+		if cfg.Check {
+			if !bytes.Equal(buf.Bytes(), data) {
+				return errors.New("input is not formatted")
+			}
+			return nil
+		} else if !cfg.usePipe() && bytes.Equal(buf.Bytes(), data) {
+			return nil // no change
+		}
+		return cfg.saveDocument(doc)
+	},
+}
+
+var cmdValidate = &command.C{
+	Name:  "validate",
+	Usage: "[path ...]",
+	Help: `Check that the input is valid TOML, without modifying it.
+
+With no arguments, the input selected by -path is checked.
+Otherwise, each named file is checked, and its status is printed.
+An error is reported if any input is not valid.`,
+
+	Run: func(env *command.Env) error {
+		cfg := env.Config.(*settings)
+		if len(env.Args) == 0 {
+			_, err := cfg.loadDocument()
+			return err
+		}
+		var nbad int
+		for _, path := range env.Args {
+			if err := validateFile(path); err != nil {
+				fmt.Printf("%s: %v\n", path, err)
+				nbad++
+			} else {
+				fmt.Printf("%s: OK\n", path)
+			}
+		}
+		if nbad != 0 {
+			return fmt.Errorf("%d of %d files are not valid", nbad, len(env.Args))
+		}
+		return nil
+	},
+}
+
+var cmdDiff = &command.C{
+	Name:  "diff",
+	Usage: "<file-a> <file-b>",
+	Help: `Print the differences between the contents of two TOML files.
+
+Each added, removed, or modified key is printed on a separate line,
+together with its values. Comments, formatting, and the order of
+definitions are ignored. An error is reported if the files differ.`,
+
+	Run: func(env *command.Env) error {
+		if len(env.Args) != 2 {
+			return env.Usagef("required arguments are <file-a> <file-b>")
+		}
+		a, err := parseFile(env.Args[0])
+		if err != nil {
+			return err
+		}
+		b, err := parseFile(env.Args[1])
+		if err != nil {
+			return err
+		}
+		diff := tomledit.Diff(a, b)
+		for _, c := range diff {
+			fmt.Println(c)
+		}
+		if len(diff) != 0 {
+			return fmt.Errorf("found %d differences", len(diff))
+		}
+		return nil
+	},
+}
+
+var cmdMerge = &command.C{
+	Name:  "merge",
+	Usage: "<overlay> ...",
+	Help: `Merge the contents of overlay files into the document.
+
+Each overlay file is merged in order. A mapping in an overlay replaces
+the value of the same key in the document, and mappings and tables that
+do not exist in the document are added.
+
+By default, arrays in an overlay replace existing arrays, and the comments
+of existing mappings are kept. Use -append to append array elements instead,
+and -overlay-comments to replace the comments of updated mappings.`,
+
+	SetFlags: func(env *command.Env, fs *flag.FlagSet) {
+		cfg := env.Config.(*settings)
+		fs.BoolVar(&cfg.Merge.AppendArrays, "append", false, "Append array elements rather than replacing arrays")
+		fs.BoolVar(&cfg.Merge.OverlayComments, "overlay-comments", false, "Replace the comments of updated mappings")
+	},
+
+	Run: func(env *command.Env) error {
+		if len(env.Args) == 0 {
+			return env.Usagef("missing required overlay argument")
+		}
+		cfg := env.Config.(*settings)
+		doc, err := cfg.loadDocument()
+		if err != nil {
+			return err
+		}
+		for _, path := range env.Args {
+			overlay, err := parseFile(path)
+			if err != nil {
+				return err
+			}
+			if err := transform.Merge(overlay, &cfg.Merge).Apply(env.Context(), doc); err != nil {
+				return fmt.Errorf("merging %s: %w", path, err)
+			}
+		}
+		return cfg.saveDocument(doc)
+	},
+}
+
+// validateFile reports whether the file at path can be parsed as TOML.
+func validateFile(path string) error {
+	_, err := parseFile(path)
+	return err
+}
+
+// parseFile parses the contents of the file at path as a TOML document.
+func parseFile(path string) (*tomledit.Document, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return tomledit.Parse(f)
+}
+
 func parseKeys(args []string) ([]parser.Key, error) {
 	var keys []parser.Key
 	for _, arg := range args {
@@ -185,6 +514,31 @@ func hasPrefixIn(needle parser.Key, keys []parser.Key) bool {
 	return len(keys) == 0
 }
 
+// formatValue renders v as text for the get command, requiring the value to
+// have the named type if typ != "".
+func formatValue(v parser.Value, typ string) (string, error) {
+	switch typ {
+	case "":
+		if s, err := v.Unquoted(); err == nil {
+			return s, nil
+		}
+		return v.String(), nil
+	case "string":
+		return v.Unquoted()
+	case "int":
+		z, err := v.Int()
+		return strconv.FormatInt(z, 10), err
+	case "float":
+		f, err := v.Float()
+		return strconv.FormatFloat(f, 'g', -1, 64), err
+	case "bool":
+		b, err := v.Bool()
+		return strconv.FormatBool(b), err
+	default:
+		return "", fmt.Errorf("unknown type %q", typ)
+	}
+}
+
 func parseValue(s string) (parser.Value, error) {
 	if strings.HasPrefix(s, "@") {
 		actual := `"` + string(scanner.Escape(s[1:])) + `"`
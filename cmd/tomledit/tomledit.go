@@ -3,15 +3,17 @@
 package main
 
 import (
-	"errors"
+	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
 	"github.com/creachadair/atomicfile"
 	"github.com/creachadair/command"
 	"github.com/creachadair/tomledit"
+	"github.com/creachadair/tomledit/transform"
 )
 
 func main() {
@@ -24,17 +26,28 @@ help [command/topic]`,
 
 For commands accepting a value, TOML syntax is required.
 As a shorthand for bare string values, prefix arguments with "@":
-The argument @foo is parsed as if it were a basic string "foo".`,
+The argument @foo is parsed as if it were a basic string "foo".
+
+If -path is empty or "-", the input is read from stdin, and commands that
+modify the document write the result to stdout instead of updating a file.`,
 
 		SetFlags: func(_ *command.Env, fs *flag.FlagSet) {
-			fs.StringVar(&cfg.Path, "path", "", "Path of TOML file to process")
+			fs.StringVar(&cfg.Path, "path", "", "Path of TOML file to process (\"-\" for stdin)")
 		},
 
 		Commands: []*command.C{
 			cmdList,
 			cmdPrint,
+			cmdGet,
 			cmdSet,
 			cmdAdd,
+			cmdDelete,
+			cmdRename,
+			cmdMove,
+			cmdFormat,
+			cmdValidate,
+			cmdDiff,
+			cmdMerge,
 			command.HelpCommand(nil),
 		},
 	}
@@ -44,27 +57,44 @@ The argument @foo is parsed as if it were a basic string "foo".`,
 type settings struct {
 	Path    string
 	Replace bool
+	All     bool
+	Values  bool
+	Type    string
+	Default *string
 	Text    string
+	Check   bool
+	Format  tomledit.Formatter
+	Merge   transform.MergeOptions
 }
 
-func (s *settings) loadDocument() (*tomledit.Document, error) {
-	if s.Path == "" {
-		return nil, errors.New("no input -path is set")
+// usePipe reports whether the document should be read from stdin and written
+// to stdout, rather than to and from a file.
+func (s *settings) usePipe() bool { return s.Path == "" || s.Path == "-" }
+
+func (s *settings) readInput() ([]byte, error) {
+	if s.usePipe() {
+		return io.ReadAll(os.Stdin)
 	}
-	f, err := os.Open(s.Path)
+	return os.ReadFile(s.Path)
+}
+
+func (s *settings) loadDocument() (*tomledit.Document, error) {
+	data, err := s.readInput()
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	return tomledit.Parse(f)
+	return tomledit.Parse(bytes.NewReader(data))
 }
 
 func (s *settings) saveDocument(doc *tomledit.Document) error {
-	if s.Path == "" {
-		return errors.New("no output -path is set")
+	if s.usePipe() {
+		if err := s.Format.Format(os.Stdout, doc); err != nil {
+			return fmt.Errorf("formatting output: %w", err)
+		}
+		return nil
 	}
 	return atomicfile.Tx(s.Path, 0600, func(f *atomicfile.File) error {
-		if err := tomledit.Format(f, doc); err != nil {
+		if err := s.Format.Format(f, doc); err != nil {
 			return fmt.Errorf("formatting output: %w", err)
 		}
 		return nil
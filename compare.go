@@ -0,0 +1,270 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package tomledit
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/creachadair/tomledit/parser"
+)
+
+// CompareOptions defines options for comparing the contents of sections.
+// The zero value compares all comments and the order of mappings.
+type CompareOptions struct {
+	// If true, ignore all block, free-standing, and trailing comments.
+	IgnoreComments bool
+
+	// If true, ignore the relative order of the key-value mappings in each
+	// section. Free-standing comment blocks are still compared in order,
+	// unless IgnoreComments is also set.
+	IgnoreOrder bool
+}
+
+// SectionsEqual reports whether sections a and b have equal headings and
+// contents, subject to the given options. Two nil sections are equal.
+//
+// Comments are compared after cleaning (see parser.Comments), so differences
+// in whitespace and comment markers are not significant.  Values are compared
+// as by parser.Value.Equal, so that for example 1000 and 1_000 are equal, and
+// the layout of arrays and any comments inside them are not significant.
+func SectionsEqual(a, b *Section, opts CompareOptions) bool {
+	if a == nil || b == nil {
+		return a == b
+	} else if !headingsEqual(a.Heading, b.Heading, opts) {
+		return false
+	}
+
+	acom, akv := splitItems(a.Items)
+	bcom, bkv := splitItems(b.Items)
+	if len(akv) != len(bkv) {
+		return false
+	}
+	if !opts.IgnoreComments {
+		if !slices.EqualFunc(acom, bcom, commentsEqual) {
+			return false
+		}
+		// When order is significant, the positions of the comments with respect
+		// to the mappings also matter.
+		if !opts.IgnoreOrder && !slices.EqualFunc(a.Items, b.Items, sameItemKind) {
+			return false
+		}
+	}
+	if opts.IgnoreOrder {
+		akv = sortedByName(akv)
+		bkv = sortedByName(bkv)
+	}
+	for i, kv := range akv {
+		if !keyValuesEqual(kv, bkv[i], opts) {
+			return false
+		}
+	}
+	return true
+}
+
+func headingsEqual(a, b *parser.Heading, opts CompareOptions) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.IsArray != b.IsArray || !a.Name.Equals(b.Name) {
+		return false
+	}
+	return opts.IgnoreComments ||
+		(commentsEqual(a.Block, b.Block) && trailersEqual(a.Trailer, b.Trailer))
+}
+
+func keyValuesEqual(a, b *parser.KeyValue, opts CompareOptions) bool {
+	if !a.Name.Equals(b.Name) || !valuesEqual(a.Value, b.Value) {
+		return false
+	}
+	return opts.IgnoreComments ||
+		(commentsEqual(a.Block, b.Block) && trailersEqual(a.Value.Trailer, b.Value.Trailer))
+}
+
+func valuesEqual(a, b parser.Value) bool { return a.Equal(b) }
+
+// datumText renders d as text, omitting comments inside arrays.
+func datumText(d parser.Datum) string {
+	switch t := d.(type) {
+	case parser.Array:
+		elts := make([]string, 0, len(t))
+		for _, v := range t.Values() {
+			elts = append(elts, datumText(v.X))
+		}
+		return "[" + strings.Join(elts, ", ") + "]"
+	case parser.Inline:
+		elts := make([]string, len(t))
+		for i, kv := range t {
+			elts[i] = kv.Name.String() + " = " + datumText(kv.Value.X)
+		}
+		return "{" + strings.Join(elts, ", ") + "}"
+	}
+	return d.String()
+}
+
+func commentsEqual(a, b parser.Comments) bool { return slices.Equal(a.Clean(), b.Clean()) }
+
+func trailersEqual(a, b string) bool {
+	if a == "" || b == "" {
+		return a == b
+	}
+	return parser.CleanTrailer(a) == parser.CleanTrailer(b)
+}
+
+// sameItemKind reports whether a and b have the same concrete type.
+func sameItemKind(a, b parser.Item) bool {
+	_, aok := a.(parser.Comments)
+	_, bok := b.(parser.Comments)
+	return aok == bok
+}
+
+// splitItems separates items into free-standing comments and mappings.
+func splitItems(items []parser.Item) (coms []parser.Comments, kvs []*parser.KeyValue) {
+	for _, item := range items {
+		switch t := item.(type) {
+		case parser.Comments:
+			coms = append(coms, t)
+		case *parser.KeyValue:
+			kvs = append(kvs, t)
+		}
+	}
+	return
+}
+
+// sortedByName returns a copy of kvs stably sorted by name.
+func sortedByName(kvs []*parser.KeyValue) []*parser.KeyValue {
+	out := slices.Clone(kvs)
+	slices.SortStableFunc(out, func(a, b *parser.KeyValue) int {
+		if a.Name.Before(b.Name) {
+			return -1
+		} else if b.Name.Before(a.Name) {
+			return 1
+		}
+		return 0
+	})
+	return out
+}
+
+// A ChangeKind identifies the kind of a Change.
+type ChangeKind int
+
+// Constants defining the kinds of changes reported by Diff.
+const (
+	Added    ChangeKind = iota + 1 // the key is present only in the new document
+	Removed                        // the key is present only in the old document
+	Modified                       // the key has different values in each document
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// A Change describes a difference between two documents, as reported by Diff.
+type Change struct {
+	Key  parser.Key // the full key of the table or mapping
+	Kind ChangeKind // the kind of change
+
+	// The values of the mapping in the old and new documents. For a table,
+	// both are empty; otherwise Old is empty for Added and New is empty for
+	// Removed.
+	Old, New parser.Value
+}
+
+// IsTable reports whether c describes the addition or removal of a table.
+func (c Change) IsTable() bool { return c.Old.X == nil && c.New.X == nil }
+
+func (c Change) String() string {
+	switch {
+	case c.IsTable():
+		return fmt.Sprintf("%s table %s", c.Kind, c.Key)
+	case c.Kind == Added:
+		return fmt.Sprintf("%s %s = %s", c.Kind, c.Key, datumText(c.New.X))
+	case c.Kind == Removed:
+		return fmt.Sprintf("%s %s = %s", c.Kind, c.Key, datumText(c.Old.X))
+	}
+	return fmt.Sprintf("%s %s = %s -> %s", c.Kind, c.Key, datumText(c.Old.X), datumText(c.New.X))
+}
+
+// Diff reports the differences between the contents of documents a and b.
+// Tables and mappings are matched by their full keys; comments, formatting,
+// and the order of definitions are ignored. Values are compared as by
+// SectionsEqual. A mapping whose value is a non-empty inline table is not
+// itself compared; instead its contents are compared as separate mappings.
+//
+// Since an array of tables defines the same keys once per element, repeated
+// keys are matched in order of occurrence, so that for example the keys of
+// the second [[x]] element in a are compared with those of the second [[x]]
+// element in b.
+//
+// Changes to keys present in a are reported in the order of a, followed by
+// keys present only in b in the order of b.
+func Diff(a, b *Document) []Change {
+	akeys, avals := diffEntries(a)
+	bkeys, bvals := diffEntries(b)
+
+	var out []Change
+	for _, k := range akeys {
+		av := avals[k]
+		bv, ok := bvals[k]
+		if !ok {
+			out = append(out, Change{Key: av.key, Kind: Removed, Old: av.value})
+		} else if (av.value.X == nil) != (bv.value.X == nil) {
+			// A table in one document is a mapping in the other.
+			out = append(out, Change{Key: av.key, Kind: Removed, Old: av.value})
+			out = append(out, Change{Key: bv.key, Kind: Added, New: bv.value})
+		} else if av.value.X != nil && !valuesEqual(av.value, bv.value) {
+			out = append(out, Change{Key: av.key, Kind: Modified, Old: av.value, New: bv.value})
+		}
+	}
+	for _, k := range bkeys {
+		if _, ok := avals[k]; !ok {
+			bv := bvals[k]
+			out = append(out, Change{Key: bv.key, Kind: Added, New: bv.value})
+		}
+	}
+	return out
+}
+
+// A diffEntry is a table or mapping to be compared by Diff. For a table, the
+// value is empty.
+type diffEntry struct {
+	key   parser.Key
+	value parser.Value
+}
+
+// diffEntries returns the entries of d to be compared by Diff, indexed by a
+// string combining the key and its occurrence number, and a slice of the index
+// keys in order of occurrence.
+func diffEntries(d *Document) ([]string, map[string]diffEntry) {
+	var order []string
+	entries := make(map[string]diffEntry)
+	seen := make(map[string]int)
+	add := func(key parser.Key, v parser.Value) {
+		ks := key.String()
+		id := fmt.Sprintf("%s#%d", ks, seen[ks])
+		seen[ks]++
+		order = append(order, id)
+		entries[id] = diffEntry{key: slices.Clone(key), value: v}
+	}
+	if d == nil {
+		return nil, entries
+	}
+	d.Scan(func(key parser.Key, e *Entry) bool {
+		if e.IsSection() {
+			add(key, parser.Value{})
+		} else if in, ok := e.Value.X.(parser.Inline); !ok || len(in) == 0 {
+			add(key, e.Value)
+		}
+		return true
+	})
+	return order, entries
+}
@@ -0,0 +1,625 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package tomledit
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/creachadair/tomledit/parser"
+	"github.com/creachadair/tomledit/scanner"
+)
+
+// ToMap converts d into a tree of Go values. Each table becomes a
+// map[string]any, each array of tables becomes a []map[string]any, and each
+// other array becomes a []any.  Scalar values are decoded to int64, float64,
+// bool, string, or time.Time according to their types. Local dates and times
+// are decoded as described by parser.Token.Time. Comments and formatting are
+// not represented in the result.
+//
+// ToMap reports an error if d defines the same key or table more than once,
+// or uses a key as both a table and a value, as the TOML specification
+// forbids.
+func (d *Document) ToMap() (map[string]any, error) { return d.toMap(tokenValue) }
+
+// toMap implements ToMap, using tv to convert scalar values.
+func (d *Document) toMap(tv func(parser.Token) (any, error)) (map[string]any, error) {
+	if err := checkDuplicates(d); err != nil {
+		return nil, err
+	}
+	root := make(map[string]any)
+	if d.Global != nil {
+		if err := setItems(root, nil, d.Global.Items, tv); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range d.Sections {
+		name := s.Heading.Name
+		parent, err := tableAt(root, name[:len(name)-1], name)
+		if err != nil {
+			return nil, err
+		}
+		last := name[len(name)-1]
+		tab := make(map[string]any)
+		if s.Heading.IsArray {
+			switch t := parent[last].(type) {
+			case nil:
+				parent[last] = []map[string]any{tab}
+			case []map[string]any:
+				parent[last] = append(t, tab)
+			default:
+				return nil, atPos(s.Heading.Pos, fmt.Errorf("%q is not an array of tables", name))
+			}
+		} else {
+			switch t := parent[last].(type) {
+			case nil:
+				parent[last] = tab
+			case map[string]any:
+				tab = t // defined implicitly by an earlier heading
+			default:
+				return nil, atPos(s.Heading.Pos, fmt.Errorf("%q is not a table", name))
+			}
+		}
+		if err := setItems(tab, name, s.Items, tv); err != nil {
+			return nil, err
+		}
+	}
+	return root, nil
+}
+
+// setItems adds the key-value mappings among items to tab, whose key is base,
+// using tv to convert scalar values.
+func setItems(tab map[string]any, base parser.Key, items []parser.Item, tv func(parser.Token) (any, error)) error {
+	for _, item := range items {
+		kv, ok := item.(*parser.KeyValue)
+		if !ok {
+			continue
+		}
+		if err := setValue(tab, base, kv, tv); err != nil {
+			return atPos(kv.Pos, err)
+		}
+	}
+	return nil
+}
+
+// atPos annotates err with the line of pos, if pos is valid. A document that
+// was not parsed from input has no positions.
+func atPos(pos parser.Position, err error) error {
+	if !pos.IsValid() {
+		return err
+	}
+	return fmt.Errorf("line %d: %w", pos.Line, err)
+}
+
+// setValue adds the value of kv to tab, whose key is base, using tv to convert
+// scalar values.
+func setValue(tab map[string]any, base parser.Key, kv *parser.KeyValue, tv func(parser.Token) (any, error)) error {
+	full := append(append(parser.Key(nil), base...), kv.Name...)
+	parent, err := tableAt(tab, kv.Name[:len(kv.Name)-1], full)
+	if err != nil {
+		return err
+	}
+	last := kv.Name[len(kv.Name)-1]
+	if _, ok := parent[last]; ok {
+		return fmt.Errorf("duplicate key %q", full)
+	}
+	v, err := datumValue(full, kv.Value.X, tv)
+	if err != nil {
+		return err
+	}
+	parent[last] = v
+	return nil
+}
+
+// tableAt returns the table in root named by key, creating tables as needed.
+// If a component of key is an array of tables, its last element is used.  The
+// full key is used for error messages.
+func tableAt(root map[string]any, key, full parser.Key) (map[string]any, error) {
+	cur := root
+	for _, name := range key {
+		switch t := cur[name].(type) {
+		case nil:
+			next := make(map[string]any)
+			cur[name] = next
+			cur = next
+		case map[string]any:
+			cur = t
+		case []map[string]any:
+			cur = t[len(t)-1]
+		default:
+			return nil, fmt.Errorf("key %q: %q is not a table", full, name)
+		}
+	}
+	return cur, nil
+}
+
+// datumValue converts d into a Go value as described by ToMap, where key is
+// the key of the value containing d, using tv to convert scalar values.
+func datumValue(key parser.Key, d parser.Datum, tv func(parser.Token) (any, error)) (any, error) {
+	switch t := d.(type) {
+	case parser.Token:
+		v, err := tv(t)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", key, err)
+		}
+		return v, nil
+	case parser.Array:
+		out := make([]any, 0, len(t))
+		for _, elt := range t {
+			if v, ok := elt.(parser.Value); ok {
+				ev, err := datumValue(key, v.X, tv)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, ev)
+			}
+		}
+		return out, nil
+	case parser.Inline:
+		out := make(map[string]any)
+		for _, kv := range t {
+			if err := setValue(out, key, kv, tv); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("key %q: unknown value type %T", key, d)
+}
+
+// tokenValue decodes the value of a scalar token.
+func tokenValue(t parser.Token) (any, error) {
+	switch t.Type {
+	case scanner.Integer:
+		return t.Int()
+	case scanner.Float:
+		return t.Float()
+	case scanner.Word:
+		return t.Bool()
+	case scanner.String, scanner.MString, scanner.LString, scanner.MLString:
+		return t.Unquote()
+	case scanner.DateTime, scanner.LocalDateTime, scanner.LocalDate, scanner.LocalTime:
+		return t.Time()
+	}
+	return nil, fmt.Errorf("unexpected %v", t.Type)
+}
+
+// FromValue constructs a document from v, which must be a struct, a map with
+// string keys, or a pointer to one of these.
+//
+// Struct fields are mapped to keys using the name given by a "toml" field tag,
+// or otherwise the name of the field. A tag of "-" omits the field, and the
+// tag option "omitempty" omits the field if it has a zero value. Unexported
+// fields are omitted, and the fields of an embedded struct without a tag are
+// treated as fields of the enclosing struct. Map entries are emitted in sorted
+// order by key. Nil pointers, interfaces, maps, and slices are omitted, since
+// TOML has no representation for them.
+//
+// Within each table, values are emitted before nested tables.  A nested struct
+// or map becomes a table section, and a non-empty slice or array of structs or
+// maps becomes an array of tables. Structs and maps inside other values become
+// inline tables. Other values are converted as by parser.ValueOf.
+func FromValue(v any) (*Document, error) {
+	rv := indirect(reflect.ValueOf(v))
+	if !isTable(rv) {
+		return nil, fmt.Errorf("cannot convert %T to a document", v)
+	}
+	var b docBuilder
+	b.doc.Global = new(Section)
+	if err := b.addTable(b.doc.Global, nil, rv); err != nil {
+		return nil, err
+	}
+	return &b.doc, nil
+}
+
+type docBuilder struct{ doc Document }
+
+// addTable adds the entries of the table v, whose name is key, to s, and
+// adds sections for its nested tables to the document.
+func (b *docBuilder) addTable(s *Section, key parser.Key, v reflect.Value) error {
+	type nested struct {
+		name string
+		v    reflect.Value
+	}
+	var tables, arrays []nested
+	for name, fv := range tableEntries(v) {
+		sub := append(append(parser.Key(nil), key...), name)
+		switch {
+		case isTable(fv):
+			tables = append(tables, nested{name, fv})
+		case isTableArray(fv):
+			arrays = append(arrays, nested{name, fv})
+		default:
+			d, err := datumOf(fv)
+			if err != nil {
+				return fmt.Errorf("key %q: %w", sub, err)
+			}
+			s.Items = append(s.Items, &parser.KeyValue{
+				Name:  parser.Key{name},
+				Value: parser.Value{X: d},
+			})
+		}
+	}
+	for _, t := range tables {
+		sub := append(append(parser.Key(nil), key...), t.name)
+		ts := &Section{Heading: &parser.Heading{Name: sub}}
+		pos := len(b.doc.Sections)
+		b.doc.Sections = append(b.doc.Sections, ts)
+		if err := b.addTable(ts, sub, t.v); err != nil {
+			return err
+		}
+		// Omit the heading for a table with no values if its contents are
+		// fully described by the headings of its nested tables.
+		if len(ts.Items) == 0 && len(b.doc.Sections) > pos+1 {
+			b.doc.Sections = slices.Delete(b.doc.Sections, pos, pos+1)
+		}
+	}
+	for _, t := range arrays {
+		sub := append(append(parser.Key(nil), key...), t.name)
+		for i := 0; i < t.v.Len(); i++ {
+			ts := &Section{Heading: &parser.Heading{Name: sub, IsArray: true}}
+			b.doc.Sections = append(b.doc.Sections, ts)
+			if err := b.addTable(ts, sub, indirect(t.v.Index(i))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// tableEntries returns an iterator over the names and values of the entries
+// of v, which must be a struct or a map with string keys, omitting nil values.
+func tableEntries(v reflect.Value) iter.Seq2[string, reflect.Value] {
+	return func(yield func(string, reflect.Value) bool) {
+		if v.Kind() == reflect.Map {
+			keys := v.MapKeys()
+			slices.SortFunc(keys, func(a, b reflect.Value) int { return cmp.Compare(a.String(), b.String()) })
+			for _, k := range keys {
+				if ev := indirect(v.MapIndex(k)); !isNil(ev) && !yield(k.String(), ev) {
+					return
+				}
+			}
+			return
+		}
+		for _, f := range structFields(v.Type()) {
+			fv, err := v.FieldByIndexErr(f.index)
+			if err != nil {
+				continue // a nil embedded pointer
+			} else if f.omitEmpty && fv.IsZero() {
+				continue
+			}
+			if ev := indirect(fv); !isNil(ev) && !yield(f.name, ev) {
+				return
+			}
+		}
+	}
+}
+
+// datumOf converts v into a datum. Structs and maps are converted into inline
+// tables, and other values are converted by parser.ValueOf.
+func datumOf(v reflect.Value) (parser.Datum, error) {
+	v = indirect(v)
+	switch {
+	case isNil(v):
+		return nil, errors.New("nil value")
+	case isTable(v):
+		var in parser.Inline
+		for name, ev := range tableEntries(v) {
+			d, err := datumOf(ev)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", name, err)
+			}
+			in = append(in, &parser.KeyValue{Name: parser.Key{name}, Value: parser.Value{X: d}})
+		}
+		return in, nil
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		arr := make(parser.Array, v.Len())
+		for i := range arr {
+			d, err := datumOf(v.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			arr[i] = parser.Value{X: d}
+		}
+		return arr, nil
+	}
+	pv, err := parser.ValueOf(v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return pv.X, nil
+}
+
+// A structField describes a struct field that is mapped to a TOML key.
+type structField struct {
+	name      string // the key name
+	index     []int  // the index sequence for reflect.Value.FieldByIndex
+	omitEmpty bool   // omit the field if it is zero
+}
+
+// structFields returns the fields of struct type t that are mapped to keys,
+// in order of declaration.
+func structFields(t reflect.Type) []structField {
+	var out []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, hasTag := f.Tag.Lookup("toml")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && !hasTag && ft.Kind() == reflect.Struct {
+			if !f.IsExported() && f.Type.Kind() == reflect.Pointer {
+				continue // cannot be allocated by Decode
+			}
+			for _, sf := range structFields(ft) {
+				sf.index = append([]int{i}, sf.index...)
+				out = append(out, sf)
+			}
+			continue
+		} else if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		out = append(out, structField{
+			name:      name,
+			index:     []int{i},
+			omitEmpty: slices.Contains(strings.Split(opts, ","), "omitempty"),
+		})
+	}
+	return out
+}
+
+// indirect follows non-nil pointers and interfaces from v.
+func indirect(v reflect.Value) reflect.Value {
+	for (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+// isNil reports whether v is invalid or a nil reference.
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// isTable reports whether v is encoded as a table.
+func isTable(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Struct:
+		return v.Type() != timeType
+	case reflect.Map:
+		return v.Type().Key().Kind() == reflect.String
+	}
+	return false
+}
+
+// isTableArray reports whether v is encoded as an array of tables, which is a
+// non-empty slice or array all of whose elements are tables.
+func isTableArray(v reflect.Value) bool {
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array || v.Len() == 0 {
+		return false
+	}
+	for i := 0; i < v.Len(); i++ {
+		if !isTable(indirect(v.Index(i))) {
+			return false
+		}
+	}
+	return true
+}
+
+// Decode populates v, which must be a non-nil pointer, from the contents of d.
+// It is shorthand for DecodeOptions{}.Decode(d, v).
+func (d *Document) Decode(v any) error { return DecodeOptions{}.Decode(d, v) }
+
+// DecodeOptions are options for decoding a document into a Go value.
+type DecodeOptions struct {
+	// If true, report an error for keys that do not correspond to any field
+	// of the struct being decoded. By default such keys are ignored.
+	DisallowUnknownKeys bool
+}
+
+// Decode populates v, which must be a non-nil pointer, from the contents of d.
+//
+// The document is first converted as by ToMap. A table is decoded into a
+// struct, a map with string keys, or an empty interface. Keys are matched to
+// struct fields as described by FromValue, preferring an exact match but
+// otherwise accepting a case-insensitive match. Arrays and arrays of tables
+// are decoded into slices, arrays, or an empty interface. Integers may be
+// decoded into any integer or floating-point type that can represent them. A
+// string may be decoded into a time.Duration as by time.ParseDuration, and a
+// date or time into a time.Time. Nil pointers are allocated as needed.
+//
+// All keys are attempted before reporting an error for any values that could
+// not be decoded, and for unknown keys if o.DisallowUnknownKeys is true.
+func (o DecodeOptions) Decode(d *Document, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("cannot decode into %T", v)
+	}
+	m, err := d.ToMap()
+	if err != nil {
+		return err
+	}
+	dec := decoder{DecodeOptions: o}
+	dec.decode(nil, m, rv.Elem())
+	return errors.Join(dec.errs...)
+}
+
+type decoder struct {
+	DecodeOptions
+	errs []error
+}
+
+func (d *decoder) fail(key parser.Key, msg string, args ...any) {
+	d.errs = append(d.errs, fmt.Errorf("key %q: %s", key, fmt.Sprintf(msg, args...)))
+}
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// decode stores src, the value of key as produced by ToMap, into dst.
+func (d *decoder) decode(key parser.Key, src any, dst reflect.Value) {
+	for dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		dst = dst.Elem()
+	}
+	if dst.Kind() == reflect.Interface && dst.NumMethod() == 0 {
+		dst.Set(reflect.ValueOf(src))
+		return
+	}
+
+	switch t := src.(type) {
+	case map[string]any:
+		d.decodeTable(key, t, dst)
+		return
+	case []map[string]any:
+		d.decodeArray(key, len(t), func(i int) any { return t[i] }, dst)
+		return
+	case []any:
+		d.decodeArray(key, len(t), func(i int) any { return t[i] }, dst)
+		return
+	case int64:
+		switch dst.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if dst.Type() != durationType && !dst.OverflowInt(t) {
+				dst.SetInt(t)
+				return
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if t >= 0 && !dst.OverflowUint(uint64(t)) {
+				dst.SetUint(uint64(t))
+				return
+			}
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(float64(t))
+			return
+		}
+	case float64:
+		if k := dst.Kind(); (k == reflect.Float32 || k == reflect.Float64) && !dst.OverflowFloat(t) {
+			dst.SetFloat(t)
+			return
+		}
+	case bool:
+		if dst.Kind() == reflect.Bool {
+			dst.SetBool(t)
+			return
+		}
+	case string:
+		if dst.Type() == durationType {
+			dur, err := time.ParseDuration(t)
+			if err != nil {
+				d.fail(key, "%v", err)
+			} else {
+				dst.SetInt(int64(dur))
+			}
+			return
+		} else if dst.Kind() == reflect.String {
+			dst.SetString(t)
+			return
+		}
+	case time.Time:
+		if dst.Type() == timeType {
+			dst.Set(reflect.ValueOf(t))
+			return
+		}
+	}
+	d.fail(key, "cannot decode %v into %v", src, dst.Type())
+}
+
+// decodeTable stores the contents of tab, the value of key, into dst.
+func (d *decoder) decodeTable(key parser.Key, tab map[string]any, dst reflect.Value) {
+	sub := func(name string) parser.Key { return append(append(parser.Key(nil), key...), name) }
+	switch dst.Kind() {
+	case reflect.Map:
+		if dst.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(dst.Type(), len(tab)))
+		}
+		for _, name := range slices.Sorted(maps.Keys(tab)) {
+			ev := reflect.New(dst.Type().Elem()).Elem()
+			d.decode(sub(name), tab[name], ev)
+			dst.SetMapIndex(reflect.ValueOf(name).Convert(dst.Type().Key()), ev)
+		}
+		return
+
+	case reflect.Struct:
+		if dst.Type() == timeType {
+			break
+		}
+		fields := structFields(dst.Type())
+		for _, name := range slices.Sorted(maps.Keys(tab)) {
+			i := slices.IndexFunc(fields, func(f structField) bool { return f.name == name })
+			if i < 0 {
+				i = slices.IndexFunc(fields, func(f structField) bool { return strings.EqualFold(f.name, name) })
+			}
+			if i < 0 {
+				if d.DisallowUnknownKeys {
+					d.fail(sub(name), "unknown key")
+				}
+				continue
+			}
+			d.decode(sub(name), tab[name], fieldByIndex(dst, fields[i].index))
+		}
+		return
+	}
+	d.fail(key, "cannot decode a table into %v", dst.Type())
+}
+
+// decodeArray stores the n elements of an array, the value of key, into dst.
+func (d *decoder) decodeArray(key parser.Key, n int, elem func(int) any, dst reflect.Value) {
+	switch dst.Kind() {
+	case reflect.Slice:
+		dst.Set(reflect.MakeSlice(dst.Type(), n, n))
+	case reflect.Array:
+		if n > dst.Len() {
+			d.fail(key, "array has %d elements, but %v has only %d", n, dst.Type(), dst.Len())
+			return
+		}
+	default:
+		d.fail(key, "cannot decode an array into %v", dst.Type())
+		return
+	}
+	for i := range n {
+		d.decode(key, elem(i), dst.Index(i))
+	}
+}
+
+// fieldByIndex returns the field of struct v with the given index sequence,
+// allocating nil embedded struct pointers along the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
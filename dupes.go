@@ -0,0 +1,162 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package tomledit
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/creachadair/tomledit/parser"
+)
+
+// defKind records how a key was defined, for checking duplicates.
+type defKind int
+
+const (
+	defImplicit defKind = iota + 1 // a table implied by a heading
+	defDotted                      // a table implied by a dotted key
+	defTable                       // a table defined by a heading
+	defArray                       // an array of tables
+	defValue                       // a value
+)
+
+// dupChecker checks a document for keys and tables defined more than once.
+type dupChecker struct {
+	defs   map[string]defKind
+	arrays map[string]int // number of elements of each array of tables
+}
+
+// checkDuplicates reports an error for the first key or table in d that is
+// defined more than once in the same table, or that is defined as a table
+// after being defined as a value, or vice versa. The error has concrete type
+// *parser.ParseError.
+func checkDuplicates(d *Document) error {
+	c := &dupChecker{defs: make(map[string]defKind), arrays: make(map[string]int)}
+	if d.Global != nil {
+		if err := c.checkItems("", d.Global.Items); err != nil {
+			return err
+		}
+	}
+	for _, s := range d.Sections {
+		if err := c.checkHeading(s.Heading); err != nil {
+			return err
+		}
+		if err := c.checkItems(c.path(s.Heading.Name), s.Items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// path returns a string identifying the table or value named by key, where
+// each segment that names an array of tables refers to its last element.
+func (c *dupChecker) path(key parser.Key) string {
+	if len(key) == 0 {
+		return ""
+	}
+	p := c.bare(key)
+	if n, ok := c.arrays[key.String()]; ok {
+		p += "#" + strconv.Itoa(n)
+	}
+	return p
+}
+
+// bare returns a string identifying the value named by key, as path, except
+// that if key names an array of tables, the result refers to the array itself
+// rather than its last element.
+func (c *dupChecker) bare(key parser.Key) string {
+	p := c.path(key[:len(key)-1])
+	if p != "" {
+		p += "."
+	}
+	return p + strconv.Quote(key[len(key)-1])
+}
+
+func (c *dupChecker) checkHeading(h *parser.Heading) error {
+	for i := 1; i < len(h.Name); i++ {
+		p := c.path(h.Name[:i])
+		switch c.defs[p] {
+		case 0:
+			c.defs[p] = defImplicit
+		case defValue:
+			return dupError(h.Pos, h.Name, "%q is not a table", h.Name[:i])
+		}
+	}
+	p := c.bare(h.Name)
+	if h.IsArray {
+		if k := c.defs[p]; k != 0 && k != defArray {
+			return dupError(h.Pos, h.Name, "%q is already defined", h.Name)
+		}
+		c.defs[p] = defArray
+		c.arrays[h.Name.String()]++
+		return nil
+	}
+	switch c.defs[p] {
+	case 0, defImplicit:
+		c.defs[p] = defTable
+		return nil
+	case defTable:
+		return dupError(h.Pos, h.Name, "duplicate table %q", h.Name)
+	}
+	return dupError(h.Pos, h.Name, "%q is already defined", h.Name)
+}
+
+// checkItems checks the mappings among items, in the table whose path is base.
+func (c *dupChecker) checkItems(base string, items []parser.Item) error {
+	for _, item := range items {
+		if kv, ok := item.(*parser.KeyValue); ok {
+			if err := c.checkKeyValue(base, kv); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *dupChecker) checkKeyValue(base string, kv *parser.KeyValue) error {
+	p := base
+	for i, seg := range kv.Name {
+		if p != "" {
+			p += "."
+		}
+		p += strconv.Quote(seg)
+		if i == len(kv.Name)-1 {
+			break
+		}
+		switch c.defs[p] {
+		case 0:
+			c.defs[p] = defDotted
+		case defDotted:
+			// OK, extending a table defined by dotted keys in the same table
+		default:
+			return dupError(kv.Pos, kv.Name, "%q is not a table that can be extended", kv.Name[:i+1])
+		}
+	}
+	if c.defs[p] != 0 {
+		return dupError(kv.Pos, kv.Name, "duplicate key %q", kv.Name)
+	}
+	c.defs[p] = defValue
+
+	// The keys of an inline table are scoped to the table.
+	if in, ok := kv.Value.X.(parser.Inline); ok {
+		for _, sub := range in {
+			if err := c.checkKeyValue(p, sub); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func dupError(pos parser.Position, key parser.Key, msg string, args ...any) error {
+	err := fmt.Errorf(msg, args...)
+	if pos.IsValid() {
+		err = fmt.Errorf("at %s: %w", pos, err)
+	}
+	return &parser.ParseError{
+		Line:   pos.Line,
+		Column: pos.Column,
+		Text:   key.String(),
+		Err:    err,
+	}
+}
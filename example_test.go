@@ -90,3 +90,45 @@ i={j=1,k=2} # L
 	// i = {j = 1, k = 2}  # L
 	//
 }
+
+func ExampleDocument_Add() {
+	doc, err := tomledit.Parse(strings.NewReader(`name = "demo"
+
+[server]
+port = 8080
+# end of server
+`))
+	if err != nil {
+		log.Fatalf("Parse: %v", err)
+	}
+
+	// Add a mapping to an existing table, and another to a new table.
+	if err := doc.Add(parser.Key{"server"}, parser.Key{"host"}, parser.MustValue(`"localhost"`), false); err != nil {
+		log.Fatalf("Add: %v", err)
+	}
+	if err := doc.Add(parser.Key{"client"}, parser.Key{"retries"}, parser.MustValue(`3`), false); err != nil {
+		log.Fatalf("Add: %v", err)
+	}
+
+	// Adding an existing mapping is an error unless replace is true.
+	if err := doc.Add(nil, parser.Key{"name"}, parser.MustValue(`"other"`), false); err != nil {
+		fmt.Println("Error:", err)
+	}
+
+	if err := tomledit.Format(os.Stdout, doc); err != nil {
+		log.Fatalf("Format: %v", err)
+	}
+	// Output:
+	//
+	// Error: key "name" exists in table ""
+	// name = "demo"
+	//
+	// [server]
+	// port = 8080
+	// host = "localhost"
+	//
+	// # end of server
+	//
+	// [client]
+	// retries = 3
+}
@@ -0,0 +1,138 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package tomledit
+
+import (
+	"strings"
+
+	"github.com/creachadair/tomledit/parser"
+	"github.com/creachadair/tomledit/scanner"
+)
+
+// A FeatureSet is a bit set of notable TOML features used by a document.
+// Use Features to compute the feature set of a document.
+//
+// To check whether a document is compatible with a consumer that supports a
+// known set of features, mask off the supported features:
+//
+//	if extra := tomledit.Features(doc) &^ supported; extra != 0 {
+//	   log.Printf("Unsupported features: %v", extra)
+//	}
+type FeatureSet uint
+
+// Constants defining the features reported by Features.
+const (
+	ArrayTables       FeatureSet = 1 << iota // array tables ([[name]])
+	InlineTables                             // non-empty inline tables ({a = 1})
+	EmptyInlineTables                        // empty inline tables ({})
+	HexIntegers                              // hexadecimal integers (0x2f)
+	OctalIntegers                            // octal integers (0o755)
+	BinaryIntegers                           // binary integers (0b1101)
+	SpecialFloats                            // infinite and NaN floats (inf, nan)
+	OffsetDateTimes                          // offset date-time (2006-01-02T15:04:05Z)
+	LocalDateTimes                           // local date-time (2006-01-02T15:04:05)
+	LocalDates                               // local date (2006-01-02)
+	LocalTimes                               // local time (15:04:05)
+
+	maxFeature = LocalTimes
+)
+
+var featureStr = [...]string{
+	"array tables",
+	"inline tables",
+	"empty inline tables",
+	"hex integers",
+	"octal integers",
+	"binary integers",
+	"special floats",
+	"offset date-times",
+	"local date-times",
+	"local dates",
+	"local times",
+}
+
+// Has reports whether all the features in f2 are present in f.
+func (f FeatureSet) Has(f2 FeatureSet) bool { return f&f2 == f2 }
+
+func (f FeatureSet) String() string {
+	if f == 0 {
+		return "(none)"
+	}
+	var ss []string
+	for i, bit := 0, FeatureSet(1); bit <= maxFeature; i, bit = i+1, bit<<1 {
+		if f&bit != 0 {
+			ss = append(ss, featureStr[i])
+		}
+	}
+	return strings.Join(ss, ", ")
+}
+
+// Features reports which notable TOML features are used by doc.
+func Features(doc *Document) FeatureSet {
+	var fs FeatureSet
+	for _, s := range append([]*Section{doc.Global}, doc.Sections...) {
+		if s == nil {
+			continue
+		}
+		if s.Heading != nil && s.Heading.IsArray {
+			fs |= ArrayTables
+		}
+		for _, item := range s.Items {
+			if kv, ok := item.(*parser.KeyValue); ok {
+				fs |= datumFeatures(kv.Value.X)
+			}
+		}
+	}
+	return fs
+}
+
+// datumFeatures reports the features used by d, including the contents of
+// arrays and inline tables.
+func datumFeatures(d parser.Datum) FeatureSet {
+	switch t := d.(type) {
+	case parser.Inline:
+		if len(t) == 0 {
+			return EmptyInlineTables
+		}
+		fs := InlineTables
+		for _, kv := range t {
+			fs |= datumFeatures(kv.Value.X)
+		}
+		return fs
+
+	case parser.Array:
+		var fs FeatureSet
+		for _, elt := range t {
+			if v, ok := elt.(parser.Value); ok {
+				fs |= datumFeatures(v.X)
+			}
+		}
+		return fs
+
+	case parser.Token:
+		text := t.String()
+		switch t.Type {
+		case scanner.Integer:
+			if strings.HasPrefix(text, "0x") {
+				return HexIntegers
+			} else if strings.HasPrefix(text, "0o") {
+				return OctalIntegers
+			} else if strings.HasPrefix(text, "0b") {
+				return BinaryIntegers
+			}
+		case scanner.Float:
+			if strings.HasSuffix(text, "inf") || strings.HasSuffix(text, "nan") {
+				return SpecialFloats
+			}
+		case scanner.DateTime:
+			return OffsetDateTimes
+		case scanner.LocalDateTime:
+			return LocalDateTimes
+		case scanner.LocalDate:
+			return LocalDates
+		case scanner.LocalTime:
+			return LocalTimes
+		}
+	}
+	return 0
+}
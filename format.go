@@ -3,9 +3,12 @@
 package tomledit
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/creachadair/tomledit/parser"
 	"github.com/creachadair/tomledit/scanner"
@@ -17,26 +20,184 @@ func Format(w io.Writer, doc *Document) error {
 	return out.Format(w, doc)
 }
 
+// FormatSections formats only the sections of doc with the specified names,
+// using default options. See Formatter.FormatSections.
+func FormatSections(w io.Writer, doc *Document, names ...parser.Key) error {
+	var out Formatter
+	return out.FormatSections(w, doc, names...)
+}
+
 // Formatter defines options for formatting a TOML document.  The zero value is
-// ready for use with default options (of which there are presently none).
-type Formatter struct{}
+// ready for use with default options.
+//
+// The formatter removes leading and trailing whitespace from comments, and
+// does not emit trailing whitespace on any line, except within the text of a
+// multi-line string value, which is copied verbatim.
+type Formatter struct {
+	// If true, emit a trailing comma after the last entry of each non-empty
+	// inline table, as permitted by the TOML v1.1 draft. By default, no
+	// trailing comma is emitted, as the TOML v1.0 specification requires.
+	InlineTrailingComma bool
+
+	// Controls the quoting of single-line string values. By default, each
+	// string is written with the quotes it had in the input.
+	StringStyle StringStyle
+
+	// Controls the case of the exponent marker ("e" or "E") in floating-point
+	// values. By default, the marker is written as it appears in the input.
+	FloatExponentCase ExponentCase
+
+	// If true, write an explicit "+" sign in the exponent of a floating-point
+	// value whose exponent is unsigned, for example "1e+6" for "1e6". By
+	// default, the sign of the exponent is written as it appears in the input.
+	FloatExplicitPlus bool
+
+	// The string used for each level of indentation, which must consist only
+	// of spaces and tabs. By default, two spaces are used.
+	Indent string
+
+	// If true, indent the contents of each table section by one level with
+	// respect to its heading. By default, table contents are not indented.
+	IndentTables bool
+
+	// If true, pad the keys of key-value mappings so that the "=" signs of
+	// each group of mappings line up. A group is a run of consecutive
+	// mappings in the same table not separated by blank lines or comments.
+	AlignValues bool
 
+	// If positive, an array that would otherwise be written on one line is
+	// instead written with one element per line if the line containing it
+	// would be longer than this many bytes. Trailing comments are not counted.
+	// Arrays containing comments, multi-line strings, or non-empty arrays or
+	// inline tables are always written with one element per line.
+	MaxLineWidth int
+
+	// If true, write each inline table whose entries have comments with one
+	// entry per line, so that the comments are preserved. The output can then
+	// be read only by a parser that accepts multi-line inline tables, as
+	// permitted by the TOML v1.1 draft (see ParseOptions.MultilineInline). By
+	// default, inline tables are written on a single line and the comments
+	// attached to their entries are omitted.
+	MultilineInline bool
+}
+
+// indentUnit returns the string used for one level of indentation.
+func (f Formatter) indentUnit() string {
+	if f.Indent == "" {
+		return "  "
+	}
+	return f.Indent
+}
+
+// ExponentCase specifies the case of the exponent marker in floating-point
+// values written by a Formatter.
+type ExponentCase int
+
+// Constants defining the supported exponent cases.
+const (
+	ExponentPreserve ExponentCase = iota // write the marker as it appears
+	ExponentLower                        // write "e"
+	ExponentUpper                        // write "E"
+)
+
+// StringStyle specifies the quoting of single-line string values written by a
+// Formatter. A basic string is written as a literal string only if its content
+// does not contain "'" or control characters other than tab. Multi-line
+// strings are not affected; see transform.NormalizeMultilineStrings.
+type StringStyle int
+
+// Constants defining the supported string styles.
+const (
+	StringPreserve StringStyle = iota // write strings as they appear
+	StringBasic                       // write basic strings ("...")
+	StringLiteral                     // write literal strings ('...') where possible
+)
+
+// Format writes doc to w in TOML format. The global section is written first,
+// followed by each section of doc.Sections, strictly in slice order. The
+// formatter never reorders sections or their items, even when the order in
+// the slice differs from the order in which the document was parsed.
 func (f Formatter) Format(w io.Writer, doc *Document) error {
+	if strings.Trim(f.Indent, " \t") != "" {
+		return fmt.Errorf("invalid indentation %q", f.Indent)
+	}
+	all, err := docItems(doc)
+	if err != nil {
+		return err
+	}
+	return f.indent(all, w, "")
+}
+
+// docItems returns the items of doc in order, with the heading of each
+// section before its contents.
+func docItems(doc *Document) ([]parser.Item, error) {
 	var all []parser.Item
 	if doc.Global != nil {
 		all = append(all, doc.Global.Items...)
 	}
 	for i, s := range doc.Sections {
 		if len(s.TableName()) == 0 {
-			return fmt.Errorf("section at offset %d has no heading", i)
+			return nil, fmt.Errorf("section at offset %d has no heading", i)
 		}
 		all = append(all, s.Heading)
 		all = append(all, s.Items...)
 	}
-	return f.indent(all, w, "")
+	return all, nil
+}
+
+// FormatSections formats only the sections of doc whose names match one of
+// the specified names, in the order they occur in doc. An empty name selects
+// the global section. If a name matches multiple sections (for example, the
+// elements of an array table), all of them are included.
+func (f Formatter) FormatSections(w io.Writer, doc *Document, names ...parser.Key) error {
+	want := func(name parser.Key) bool {
+		for _, n := range names {
+			if n.Equals(name) {
+				return true
+			}
+		}
+		return false
+	}
+	sub := new(Document)
+	if doc.Global != nil && want(nil) {
+		sub.Global = doc.Global
+	}
+	for _, s := range doc.Sections {
+		if want(s.TableName()) {
+			sub.Sections = append(sub.Sections, s)
+		}
+	}
+	return f.Format(w, sub)
+}
+
+// Format returns the formatted text of e using default options, including
+// any comments attached to it. For a section, the result includes the heading
+// and the complete contents of the section. For a mapping, the result is the
+// key-value definition alone.  Each line of the result ends with a newline.
+func (e *Entry) Format() string {
+	var items []parser.Item
+	if e.IsMapping() {
+		items = append(items, e.KeyValue)
+	} else {
+		if e.Heading != nil {
+			items = append(items, e.Heading)
+		}
+		items = append(items, e.Items...)
+	}
+	var buf strings.Builder
+	var f Formatter
+	if err := f.indent(items, &buf, ""); err != nil {
+		return fmt.Sprintf("<invalid: %v>", err)
+	}
+	return buf.String()
 }
 
 func (f Formatter) indent(items []parser.Item, w io.Writer, prefix string) error {
+	var widths []int
+	if f.AlignValues {
+		widths = keyWidths(items)
+	}
+	cur := prefix // the indentation of items after the most recent heading
 	for i, item := range items {
 		// If the current item wants extra space, or the previous item was a
 		// block comment, inject a newline prior to rendering the value.  The
@@ -45,14 +206,26 @@ func (f Formatter) indent(items []parser.Item, w io.Writer, prefix string) error
 		if i > 0 && (wantsBlank(item) || isComment(items[i-1])) {
 			fmt.Fprintln(w)
 		}
-		if err := f.indentItem(item, w, prefix); err != nil {
+		_, isHeading := item.(*parser.Heading)
+		if isHeading {
+			cur = prefix
+		}
+		if kv, ok := item.(*parser.KeyValue); ok && widths != nil {
+			if err := f.indentKeyValue(kv, w, cur, widths[i]); err != nil {
+				return err
+			}
+		} else if err := f.indentItem(item, w, cur); err != nil {
 			return err
 		}
+		if isHeading && f.IndentTables {
+			cur = prefix + f.indentUnit()
+		}
 	}
 	return nil
 }
 
 func (f Formatter) indentItem(item parser.Item, w io.Writer, prefix string) error {
+	w = columns(w)
 	switch t := item.(type) {
 	case parser.Comments:
 		for _, line := range t.Clean() {
@@ -70,20 +243,7 @@ func (f Formatter) indentItem(item parser.Item, w io.Writer, prefix string) erro
 		fmt.Fprintln(w)
 
 	case *parser.KeyValue:
-		if err := f.indentItem(t.Block, w, prefix); err != nil {
-			return err
-		}
-		fmt.Fprint(w, prefix, t.Name, " = ")
-
-		// N.B. Do not pre-indent the RHS of a key-value mapping.
-		if err := f.indentDatum(t.Value.X, w, prefix); err != nil {
-			return err
-		}
-
-		if t.Value.Trailer != "" {
-			fmt.Fprint(w, "  ", parser.CleanTrailer(t.Value.Trailer))
-		}
-		fmt.Fprintln(w)
+		return f.indentKeyValue(t, w, prefix, 0)
 
 	default:
 		return fmt.Errorf("invalid item type %T", item)
@@ -92,6 +252,55 @@ func (f Formatter) indentItem(item parser.Item, w io.Writer, prefix string) erro
 	return nil
 }
 
+// indentKeyValue writes kv to w, padding its key to at least width columns.
+func (f Formatter) indentKeyValue(kv *parser.KeyValue, w io.Writer, prefix string, width int) error {
+	w = columns(w)
+	if err := f.indentItem(kv.Block, w, prefix); err != nil {
+		return err
+	}
+	name := kv.Name.String()
+	pad := max(width-utf8.RuneCountInString(name), 0)
+	fmt.Fprint(w, prefix, name, strings.Repeat(" ", pad), " = ")
+
+	// N.B. Do not pre-indent the RHS of a key-value mapping.
+	if err := f.formatDatum(kv.Value.X, w, prefix); err != nil {
+		return err
+	}
+
+	if kv.Value.Trailer != "" {
+		fmt.Fprint(w, "  ", parser.CleanTrailer(kv.Value.Trailer))
+	}
+	fmt.Fprintln(w)
+	return nil
+}
+
+// keyWidths returns a slice parallel to items giving, for each key-value
+// mapping, the width of the longest key in its group (see AlignValues).
+func keyWidths(items []parser.Item) []int {
+	widths := make([]int, len(items))
+	start := 0 // the first item of the current group
+	flush := func(end int) {
+		n := 0
+		for _, item := range items[start:end] {
+			n = max(n, utf8.RuneCountInString(item.(*parser.KeyValue).Name.String()))
+		}
+		for i := start; i < end; i++ {
+			widths[i] = n
+		}
+	}
+	for i, item := range items {
+		if _, ok := item.(*parser.KeyValue); !ok || wantsBlank(item) {
+			flush(i)
+			start = i
+			if !ok {
+				start++
+			}
+		}
+	}
+	flush(len(items))
+	return widths
+}
+
 func (f Formatter) indentArrayItem(item parser.ArrayItem, w io.Writer, prefix string) error {
 	switch t := item.(type) {
 	case parser.Comments:
@@ -112,19 +321,76 @@ func (f Formatter) indentArrayItem(item parser.ArrayItem, w io.Writer, prefix st
 }
 
 func (f Formatter) indentDatum(datum parser.Datum, w io.Writer, prefix string) error {
+	fmt.Fprint(w, prefix)
+	return f.formatDatum(datum, w, prefix)
+}
+
+// formatDatum writes datum to w. The first line is not indented, but any
+// subsequent lines of a compound value are indented by prefix.
+func (f Formatter) formatDatum(datum parser.Datum, w io.Writer, prefix string) error {
 	switch t := datum.(type) {
 	case parser.Array:
 		return f.indentArray(t, w, prefix)
 	case parser.Inline:
 		return f.indentInline(t, w, prefix)
+	case parser.Token:
+		switch t.Type {
+		case scanner.Float:
+			fmt.Fprint(w, f.formatFloat(t.String()))
+			return nil
+		case scanner.String, scanner.LString:
+			fmt.Fprint(w, f.formatString(t))
+			return nil
+		}
 	}
-	fmt.Fprint(w, prefix, datum.String())
+	fmt.Fprint(w, datum.String())
 	return nil
 }
 
+// formatFloat applies the exponent options of f to the text of a float.
+func (f Formatter) formatFloat(text string) string {
+	i := strings.IndexAny(text, "eE")
+	if i < 0 {
+		return text // no exponent, or inf or nan
+	}
+	mark, exp := text[i:i+1], text[i+1:]
+	switch f.FloatExponentCase {
+	case ExponentLower:
+		mark = "e"
+	case ExponentUpper:
+		mark = "E"
+	}
+	if f.FloatExplicitPlus && exp != "" && exp[0] != '+' && exp[0] != '-' {
+		exp = "+" + exp
+	}
+	return text[:i] + mark + exp
+}
+
+// formatString applies the string style of f to the text of a single-line
+// string token.
+func (f Formatter) formatString(t parser.Token) string {
+	if f.StringStyle == StringPreserve ||
+		(f.StringStyle == StringBasic) == (t.Type == scanner.String) {
+		return t.String()
+	}
+	s, err := t.Unquote()
+	if err != nil {
+		return t.String()
+	}
+	if f.StringStyle == StringBasic {
+		return `"` + string(scanner.Escape(s)) + `"`
+	}
+	for _, c := range s {
+		if c == '\'' || (unicode.IsControl(c) && c != '\t') {
+			return t.String()
+		}
+	}
+	return "'" + s + "'"
+}
+
 func (f Formatter) indentArray(array parser.Array, w io.Writer, prefix string) error {
 	if len(array) == 0 {
-		fmt.Fprint(w, prefix, "[]")
+		fmt.Fprint(w, "[]")
 		return nil
 	}
 
@@ -132,50 +398,125 @@ func (f Formatter) indentArray(array parser.Array, w io.Writer, prefix string) e
 	// comments, or any of the values is itself a multi-line string, or a
 	// non-empty array or inline table, format this array with indentation.
 	if shouldIndentArray(array) {
-		fmt.Fprint(w, prefix, "[\n")
-		for _, elt := range array {
-			if err := f.indentArrayItem(elt, w, prefix+"  "); err != nil {
-				return err
-			}
-			if v, ok := elt.(parser.Value); ok {
-				fmt.Fprint(w, ",")
-				if v.Trailer != "" {
-					fmt.Fprint(w, "  ", parser.CleanTrailer(v.Trailer))
-				}
-			}
-			fmt.Fprintln(w)
-		}
-		fmt.Fprint(w, prefix, "]")
-		return nil
+		return f.indentArrayLines(array, w, prefix)
 	}
 
 	// Reaching here, we know there are no comments or compound values, so we
-	// can just format everything plainly.
+	// can just format everything plainly, unless that makes the line too long.
 	elts := make([]string, len(array))
 	for i, elt := range array {
-		elts[i] = fmt.Sprint(elt)
+		var buf strings.Builder
+		if err := f.indentArrayItem(elt, &buf, ""); err != nil {
+			return err
+		}
+		elts[i] = buf.String()
 	}
-	fmt.Fprint(w, prefix, "[", strings.Join(elts, ", "), "]")
+	line := "[" + strings.Join(elts, ", ") + "]"
+	if cw, ok := w.(*colWriter); ok && f.MaxLineWidth > 0 && cw.col+len(line) > f.MaxLineWidth {
+		return f.indentArrayLines(array, w, prefix)
+	}
+	fmt.Fprint(w, line)
+	return nil
+}
+
+// indentArrayLines writes array to w with each element on its own line.
+func (f Formatter) indentArrayLines(array parser.Array, w io.Writer, prefix string) error {
+	fmt.Fprint(w, "[\n")
+	for _, elt := range array {
+		if err := f.indentArrayItem(elt, w, prefix+f.indentUnit()); err != nil {
+			return err
+		}
+		// Comment lines are already terminated.
+		if v, ok := elt.(parser.Value); ok {
+			fmt.Fprint(w, ",")
+			if v.Trailer != "" {
+				fmt.Fprint(w, "  ", parser.CleanTrailer(v.Trailer))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	fmt.Fprint(w, prefix, "]")
 	return nil
 }
 
+// A colWriter tracks the current column of the text written to an io.Writer,
+// as a number of bytes since the last newline.
+type colWriter struct {
+	w   io.Writer
+	col int
+}
+
+// columns returns w as a *colWriter, wrapping it if it is not already one.
+func columns(w io.Writer) *colWriter {
+	if cw, ok := w.(*colWriter); ok {
+		return cw
+	}
+	return &colWriter{w: w}
+}
+
+func (c *colWriter) Write(data []byte) (int, error) {
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		c.col = len(data) - i - 1
+	} else {
+		c.col += len(data)
+	}
+	return c.w.Write(data)
+}
+
 func (f Formatter) indentInline(inline parser.Inline, w io.Writer, prefix string) error {
 	if len(inline) == 0 {
-		fmt.Fprint(w, prefix, "{}")
+		fmt.Fprint(w, "{}")
 		return nil
 	}
 
-	// The key-value mappings in an inline table cannot have their own comments
-	// or newlines at the top level, but may have them inside string literals or
-	// compound values.
-	fmt.Fprint(w, prefix, "{")
+	// The key-value mappings in an inline table do not usually have their own
+	// comments or newlines at the top level, but may have them inside string
+	// literals or compound values. If they do have comments and the caller
+	// has opted in, write the table with one entry per line so that the
+	// comments are preserved; otherwise the comments are dropped.
+	if f.MultilineInline && inline.HasComments() {
+		return f.indentInlineLines(inline, w, prefix)
+	}
+	fmt.Fprint(w, "{")
 	for i, elt := range inline {
-		fmt.Fprint(w, prefix, elt.Name, " = ")
-		if err := f.indentDatum(elt.Value.X, w, prefix); err != nil {
+		fmt.Fprint(w, elt.Name, " = ")
+		if err := f.formatDatum(elt.Value.X, w, prefix); err != nil {
 			return err
 		}
 		if i+1 < len(inline) {
 			fmt.Fprint(w, ", ")
+		} else if f.InlineTrailingComma {
+			fmt.Fprint(w, ",")
+		}
+	}
+	fmt.Fprint(w, "}")
+	return nil
+}
+
+// indentInlineLines writes inline to w with each entry on its own line,
+// preceded by its block comment and followed by its tail comment, if any.
+// This layout requires a parser that accepts multi-line inline tables, as
+// permitted by the TOML v1.1 draft.
+func (f Formatter) indentInlineLines(inline parser.Inline, w io.Writer, prefix string) error {
+	fmt.Fprint(w, "{\n")
+	inner := prefix + f.indentUnit()
+	for i, elt := range inline {
+		for _, line := range elt.Block.Clean() {
+			fmt.Fprint(w, inner, line, "\n")
+		}
+		fmt.Fprint(w, inner, elt.Name, " = ")
+		if err := f.formatDatum(elt.Value.X, w, inner); err != nil {
+			return err
+		}
+		if i+1 < len(inline) || f.InlineTrailingComma {
+			fmt.Fprint(w, ",")
+		}
+		if elt.Value.Trailer != "" {
+			fmt.Fprint(w, "  ", parser.CleanTrailer(elt.Value.Trailer))
+		}
+		fmt.Fprintln(w)
+		for _, line := range elt.Tail.Clean() {
+			fmt.Fprint(w, inner, line, "\n")
 		}
 	}
 	fmt.Fprint(w, prefix, "}")
@@ -218,7 +559,7 @@ func wantsBlank(item parser.Item) bool {
 	case *parser.Heading:
 		return true
 	case *parser.KeyValue:
-		return len(t.Block) != 0
+		return len(t.Block) != 0 || t.BlankBefore
 	}
 	return false
 }
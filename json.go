@@ -0,0 +1,128 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package tomledit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/creachadair/tomledit/parser"
+	"github.com/creachadair/tomledit/scanner"
+)
+
+// WriteJSON writes the contents of d to w as a JSON object, with the structure
+// described by ToMap. Tables become JSON objects, and arrays, including arrays
+// of tables, become JSON arrays. Integers, floats, booleans, and strings are
+// written as the corresponding JSON values.
+//
+// Since JSON has no representation for them, date and time values are written
+// as strings. An offset date-time is written in RFC 3339 format. Local
+// date-times, dates, and times are written in the corresponding RFC 3339
+// formats without an offset, for example "1979-05-27T07:32:00", "1979-05-27",
+// and "07:32:00". Floating-point infinities and NaN are written as the strings
+// "inf", "-inf", and "nan".
+//
+// WriteJSON reports an error if d cannot be converted by ToMap.
+func (d *Document) WriteJSON(w io.Writer) error {
+	m, err := d.toMap(jsonValue)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// jsonValue decodes the value of a scalar token for WriteJSON.
+func jsonValue(t parser.Token) (any, error) {
+	if t.Type == scanner.Float {
+		f, err := t.Float()
+		if err != nil {
+			return nil, err
+		} else if math.IsNaN(f) {
+			return "nan", nil
+		} else if math.IsInf(f, 1) {
+			return "inf", nil
+		} else if math.IsInf(f, -1) {
+			return "-inf", nil
+		}
+		return f, nil
+	}
+	layout, ok := parser.TimeLayout(t.Type)
+	if !ok {
+		return tokenValue(t)
+	}
+	ts, err := t.Time()
+	if err != nil {
+		return nil, err
+	}
+	return ts.Format(layout), nil
+}
+
+// ParseJSON reads a JSON object from r and returns an equivalent document, as
+// constructed by FromValue. Objects become tables, arrays whose elements are
+// all objects become arrays of tables, and other values become mappings.
+// Numbers that are integers are converted to TOML integers, and other numbers
+// to floats. Null values, including null elements of arrays, are omitted,
+// since TOML has no representation for them.
+//
+// ParseJSON reports an error if r does not contain a single JSON object.
+func ParseJSON(r io.Reader) (*Document, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("decoding JSON: %w", err)
+	} else if obj == nil {
+		return nil, errors.New("decoding JSON: input is not an object")
+	} else if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("decoding JSON: extra data after object")
+	}
+	v, err := fromJSON(obj)
+	if err != nil {
+		return nil, err
+	}
+	return FromValue(v)
+}
+
+// fromJSON converts the numbers in a value decoded from JSON into int64 or
+// float64 values, and removes null elements from arrays.
+func fromJSON(v any) (any, error) {
+	switch t := v.(type) {
+	case json.Number:
+		if z, err := t.Int64(); err == nil {
+			return z, nil
+		}
+		f, err := t.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q: %w", t, err)
+		}
+		return f, nil
+	case []any:
+		out := t[:0]
+		for _, elt := range t {
+			if elt == nil {
+				continue
+			}
+			ev, err := fromJSON(elt)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, ev)
+		}
+		return out, nil
+	case map[string]any:
+		for key, elt := range t {
+			ev, err := fromJSON(elt)
+			if err != nil {
+				return nil, err
+			}
+			t[key] = ev
+		}
+	}
+	return v, nil
+}
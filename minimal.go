@@ -0,0 +1,218 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package tomledit
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/creachadair/tomledit/parser"
+)
+
+// FormatMinimal formats doc using default options, reusing the source text of
+// original for items that are unchanged, where original is the text from which
+// doc was parsed. The result differs from original only in the lines of items
+// that were added, removed, or changed in doc, so that editing a single value
+// produces a one-line difference.
+//
+// An item (a heading, mapping, or free-standing comment block) is unchanged
+// if it formats identically in doc and in original. An item that is changed
+// in place keeps the original text of its block comment, if that is also
+// unchanged. The blank lines before an item that replaces or retains an item
+// of original are copied from original, when the preceding item also comes
+// from earlier in original. Elsewhere, blank lines are added as by Format.
+func FormatMinimal(w io.Writer, original []byte, doc *Document) error {
+	p := parser.New(bytes.NewReader(original))
+	oitems, err := p.Items()
+	if err != nil {
+		return err
+	}
+	spans := p.ItemLines()
+	lines := strings.SplitAfter(string(original), "\n")
+
+	items, err := docItems(doc)
+	if err != nil {
+		return err
+	}
+	var f Formatter
+	render := func(item parser.Item) (string, error) {
+		var buf strings.Builder
+		err := f.indentItem(item, &buf, "")
+		return buf.String(), err
+	}
+	otext := make([]string, len(oitems))
+	for i, item := range oitems {
+		if otext[i], err = render(item); err != nil {
+			return err
+		}
+	}
+	ntext := make([]string, len(items))
+	for i, item := range items {
+		if ntext[i], err = render(item); err != nil {
+			return err
+		}
+	}
+
+	// srcLines returns the text of original lines lo..hi (1-based, inclusive).
+	srcLines := func(lo, hi int) string {
+		if lo < 1 || hi < lo {
+			return ""
+		}
+		return strings.Join(lines[lo-1:hi], "")
+	}
+
+	var out strings.Builder
+	corr, same := alignItems(otext, ntext)
+	for i, item := range items {
+		k := corr[i]
+		if i == 0 && k == 0 {
+			out.WriteString(srcLines(1, spans[0].First-1)) // leading blank lines
+		} else if i > 0 && k > 0 && corr[i-1] >= 0 && corr[i-1] < k {
+			// Copy the original space before item k, unless that would join
+			// the previous item to a free-standing comment.
+			gap := srcLines(spans[k-1].Last+1, spans[k].First-1)
+			if gap == "" && isComment(items[i-1]) {
+				gap = "\n"
+			}
+			out.WriteString(gap)
+		} else if i > 0 && (wantsBlank(item) || isComment(items[i-1])) {
+			out.WriteString("\n")
+		}
+		if same[i] {
+			text := srcLines(spans[k].First, spans[k].Last)
+			if !strings.HasSuffix(text, "\n") && i+1 < len(items) {
+				text += "\n"
+			}
+			out.WriteString(text)
+		} else if nb := sameBlock(oitems, k, item); nb > 0 {
+			// The item replaces an original item with the same block comment.
+			// Copy the block and format the rest.
+			out.WriteString(srcLines(spans[k].First, spans[k].First+nb-1))
+			text, err := render(withoutBlock(item))
+			if err != nil {
+				return err
+			}
+			out.WriteString(text)
+		} else {
+			out.WriteString(ntext[i])
+		}
+	}
+	if n := len(items); n != 0 && same[n-1] && corr[n-1] == len(oitems)-1 {
+		out.WriteString(srcLines(spans[len(spans)-1].Last+1, len(lines))) // trailing blank lines
+	}
+	_, err = io.WriteString(w, out.String())
+	return err
+}
+
+// sameBlock returns the number of lines in the block comment of item, if k is
+// the offset of an item of oitems with an identical non-empty block comment.
+// Otherwise it returns 0.
+func sameBlock(oitems []parser.Item, k int, item parser.Item) int {
+	if k < 0 {
+		return 0
+	}
+	ob, nb := blockOf(oitems[k]), blockOf(item)
+	if len(nb) == 0 || len(ob) != len(nb) || ob.String() != nb.String() {
+		return 0
+	}
+	return len(ob)
+}
+
+func blockOf(item parser.Item) parser.Comments {
+	switch t := item.(type) {
+	case *parser.Heading:
+		return t.Block
+	case *parser.KeyValue:
+		return t.Block
+	}
+	return nil
+}
+
+// withoutBlock returns a copy of item with its block comment removed.
+func withoutBlock(item parser.Item) parser.Item {
+	switch t := item.(type) {
+	case *parser.Heading:
+		c := *t
+		c.Block = nil
+		return &c
+	case *parser.KeyValue:
+		c := *t
+		c.Block = nil
+		return &c
+	}
+	return item
+}
+
+// alignItems aligns the formatted items of an edited document (ntext) with the
+// formatted items of the original (otext). For each edited item i, corr[i] is
+// the offset of the corresponding original item, or -1 if there is none, and
+// same[i] reports whether the item is unchanged.
+//
+// Unchanged items are matched by a longest common subsequence. Between matches,
+// edited items are paired in order with the unmatched original items at the
+// same position, if any, which they are taken to replace.
+func alignItems(otext, ntext []string) (corr []int, same []bool) {
+	corr = make([]int, len(ntext))
+	same = make([]bool, len(ntext))
+	for i := range corr {
+		corr[i] = -1
+	}
+
+	// Match the common prefix and suffix directly, and use dynamic
+	// programming only for the remainder, which is usually small.
+	lo := 0
+	for lo < len(otext) && lo < len(ntext) && otext[lo] == ntext[lo] {
+		corr[lo], same[lo] = lo, true
+		lo++
+	}
+	ohi, nhi := len(otext), len(ntext)
+	for ohi > lo && nhi > lo && otext[ohi-1] == ntext[nhi-1] {
+		ohi--
+		nhi--
+		corr[nhi], same[nhi] = ohi, true
+	}
+
+	// lcs[i][j] is the length of the LCS of otext[lo+i:ohi] and ntext[lo+j:nhi].
+	no, nn := ohi-lo, nhi-lo
+	lcs := make([][]int, no+1)
+	for i := range lcs {
+		lcs[i] = make([]int, nn+1)
+	}
+	for i := no - 1; i >= 0; i-- {
+		for j := nn - 1; j >= 0; j-- {
+			if otext[lo+i] == ntext[lo+j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// Walk the table, pairing unmatched items between consecutive matches.
+	var odel, nins []int
+	pair := func() {
+		for n := 0; n < len(odel) && n < len(nins); n++ {
+			corr[nins[n]] = odel[n]
+		}
+		odel, nins = odel[:0], nins[:0]
+	}
+	i, j := 0, 0
+	for i < no || j < nn {
+		switch {
+		case i < no && j < nn && otext[lo+i] == ntext[lo+j]:
+			pair()
+			corr[lo+j], same[lo+j] = lo+i, true
+			i++
+			j++
+		case j == nn || (i < no && lcs[i+1][j] >= lcs[i][j+1]):
+			odel = append(odel, lo+i)
+			i++
+		default:
+			nins = append(nins, lo+j)
+			j++
+		}
+	}
+	pair()
+	return corr, same
+}
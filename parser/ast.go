@@ -3,9 +3,19 @@
 package parser
 
 import (
+	"cmp"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/creachadair/tomledit/scanner"
 )
@@ -72,6 +82,7 @@ type Heading struct {
 	IsArray bool     // whether this table is part of a table array
 	Name    Key      // the name of the table
 	Line    int      // the input line where the heading was defined (1-based)
+	Pos     Position // the input position of the opening bracket
 }
 
 func (Heading) isItem() {}
@@ -85,12 +96,38 @@ func (h *Heading) String() string {
 	return fmt.Sprintf("[%s]", h.Name)
 }
 
+// A Position is a location in the input to a Parser. Positions are recorded
+// by the parser for information only; they are not used by the formatter, and
+// are not updated when a document is edited. The zero value denotes an item
+// that was not parsed from input.
+type Position struct {
+	Line   int // line number, 1-based
+	Column int // byte offset of column in line, 0-based
+	Offset int // byte offset in the input, 0-based
+}
+
+// IsValid reports whether p denotes a location in the input.
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+func (p Position) String() string { return fmt.Sprintf("%d:%d", p.Line, p.Column) }
+
 // KeyValue is an Item that represents a key-value definition.
 type KeyValue struct {
 	Block Comments // a block comment before the key-value pair (empty if none)
 	Name  Key
 	Value Value
-	Line  int // the input line where the key-value was defined (1-based)
+	Line  int      // the input line where the key-value was defined (1-based)
+	Pos   Position // the input position of the start of the key
+
+	// If true, the key-value pair was preceded by one or more blank lines in
+	// the input, and a formatter should separate it from the previous item by
+	// a blank line. This is not recorded for the entries of inline tables.
+	BlankBefore bool
+
+	// For the last entry of a multi-line inline table, a block of comments
+	// following the entry, before the closing brace of the table (empty if
+	// none). This is not used for other key-value pairs.
+	Tail Comments
 }
 
 func (KeyValue) isItem() {}
@@ -125,6 +162,23 @@ func (k Key) Equals(k2 Key) bool {
 	return k.IsPrefixOf(k2) && len(k) == len(k2)
 }
 
+// Child returns a new key consisting of the segments of k followed by seg.
+// The result does not share storage with k.
+func (k Key) Child(seg ...string) Key {
+	out := make(Key, 0, len(k)+len(seg))
+	return append(append(out, k...), seg...)
+}
+
+// Parent returns a key consisting of all but the last segment of k, or nil if
+// k is empty. The result shares storage with k, but its capacity is limited so
+// that appending to it does not modify k.
+func (k Key) Parent() Key {
+	if len(k) == 0 {
+		return nil
+	}
+	return k[: len(k)-1 : len(k)-1]
+}
+
 // Before reports whether k is lexicographically prior to k2.
 func (k Key) Before(k2 Key) bool {
 	i, j := 0, 0
@@ -140,6 +194,53 @@ func (k Key) Before(k2 Key) bool {
 	return i == len(k) && j < len(k2)
 }
 
+// BeforeNatural reports whether k is prior to k2 in natural order.  Natural
+// order is lexicographic, except that runs of decimal digits within segments
+// are compared by their numeric value, so that for example "node2" is before
+// "node10". Numerically equal runs with more leading zeros sort later.
+func (k Key) BeforeNatural(k2 Key) bool {
+	for i := 0; i < len(k) && i < len(k2); i++ {
+		if c := compareNatural(k[i], k2[i]); c != 0 {
+			return c < 0
+		}
+	}
+	return len(k) < len(k2)
+}
+
+// compareNatural compares a and b in natural order, returning -1, 0, or 1.
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		ra, rb := leadingRun(a), leadingRun(b)
+		a, b = a[len(ra):], b[len(rb):]
+		if isDigit(ra[0]) && isDigit(rb[0]) {
+			na, nb := strings.TrimLeft(ra, "0"), strings.TrimLeft(rb, "0")
+			if c := cmp.Compare(len(na), len(nb)); c != 0 {
+				return c
+			} else if c := strings.Compare(na, nb); c != 0 {
+				return c
+			} else if c := cmp.Compare(len(ra), len(rb)); c != 0 {
+				return c
+			}
+		} else if c := strings.Compare(ra, rb); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// leadingRun returns the longest non-empty prefix of s consisting entirely of
+// digits or entirely of non-digits.
+func leadingRun(s string) string {
+	d := isDigit(s[0])
+	i := 1
+	for i < len(s) && isDigit(s[i]) == d {
+		i++
+	}
+	return s[:i]
+}
+
+func isDigit(b byte) bool { return '0' <= b && b <= '9' }
+
 // IsPrefixOf reports whether k is a prefix of k2.
 func (k Key) IsPrefixOf(k2 Key) bool {
 	if len(k) > len(k2) {
@@ -207,11 +308,382 @@ func ParseValue(s string) (Value, error) {
 	return val, nil
 }
 
+// ParseItem parses s as a single TOML item, a key-value mapping, a table
+// heading, or a block of comments. A block comment immediately preceding a
+// mapping or heading is attached to it, as in the output of Items. The
+// concrete type of a successful result is *KeyValue, *Heading, or Comments.
+func ParseItem(s string) (Item, error) {
+	p := New(strings.NewReader(s))
+	item, err := p.parseItem()
+	if err == io.EOF {
+		return nil, errors.New("no item found in input")
+	} else if err != nil {
+		return nil, err
+	}
+	if _, err := p.parseItem(); err != io.EOF {
+		return nil, fmt.Errorf("at %s: extra input after item", p.sc.Location().First)
+	}
+	return item, nil
+}
+
+// DurationValue returns a string value representing d in the format accepted
+// by time.ParseDuration, for example "1m30s".  TOML has no duration type, but
+// storing durations as strings with units is a common convention.
+func DurationValue(d time.Duration) Value {
+	return Value{X: Token{Type: scanner.String, text: `"` + d.String() + `"`}}
+}
+
+// Encoding is a text encoding for binary data stored in string values.
+type Encoding int
+
+// Constants defining the supported encodings.
+const (
+	Base64    Encoding = iota // standard base64 with padding (RFC 4648)
+	Base64URL                 // URL-safe base64 with padding (RFC 4648)
+	Hex                       // lower-case hexadecimal
+)
+
+// Encode returns the encoding of b. It reports an error if e is not one of
+// the supported encodings.
+func (e Encoding) Encode(b []byte) (string, error) {
+	switch e {
+	case Base64:
+		return base64.StdEncoding.EncodeToString(b), nil
+	case Base64URL:
+		return base64.URLEncoding.EncodeToString(b), nil
+	case Hex:
+		return hex.EncodeToString(b), nil
+	}
+	return "", fmt.Errorf("invalid encoding %d", e)
+}
+
+// Decode decodes s, which must be encoded with e.
+func (e Encoding) Decode(s string) ([]byte, error) {
+	var b []byte
+	var err error
+	switch e {
+	case Base64:
+		b, err = base64.StdEncoding.DecodeString(s)
+	case Base64URL:
+		b, err = base64.URLEncoding.DecodeString(s)
+	case Hex:
+		b, err = hex.DecodeString(s)
+	default:
+		return nil, fmt.Errorf("invalid encoding %d", e)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// BytesValue returns a string value containing b encoded with enc.  TOML has
+// no type for binary data, but storing it as encoded strings is a common
+// convention. It reports an error if enc is not one of the supported
+// encodings.
+func BytesValue(b []byte, enc Encoding) (Value, error) {
+	s, err := enc.Encode(b)
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{X: Token{Type: scanner.String, text: `"` + s + `"`}}, nil
+}
+
+// IntValue returns an integer value representing z.
+func IntValue(z int64) Value {
+	return Value{X: Token{Type: scanner.Integer, text: strconv.FormatInt(z, 10)}}
+}
+
+// FloatValue returns a floating-point value representing f. The text of the
+// value always includes a decimal point or exponent, so that it is not read
+// back as an integer.
+func FloatValue(f float64) Value {
+	return Value{X: Token{Type: scanner.Float, text: formatFloat(f, 64)}}
+}
+
+// BoolValue returns a Boolean value representing b.
+func BoolValue(b bool) Value {
+	return Value{X: Token{Type: scanner.Word, text: strconv.FormatBool(b)}}
+}
+
+// StringValue returns a basic string value with content s, escaped as needed.
+func StringValue(s string) Value {
+	return Value{X: Token{Type: scanner.String, text: `"` + string(scanner.Escape(s)) + `"`}}
+}
+
+// TimeValue returns an offset date-time value representing t, in RFC 3339
+// format with as many fractional digits as needed.
+func TimeValue(t time.Time) Value {
+	return Value{X: Token{Type: scanner.DateTime, text: t.Format(time.RFC3339Nano)}}
+}
+
+// ArrayValue returns an array value containing the given values, in order.
+// Any trailing comments on the values are retained.
+func ArrayValue(vs ...Value) Value {
+	arr := make(Array, len(vs))
+	for i, v := range vs {
+		arr[i] = v
+	}
+	return Value{X: arr}
+}
+
+// ArrayOf returns an array value containing the results of calling conv for
+// each element of xs, in order. For example:
+//
+//	ArrayOf([]int64{1, 2, 3}, IntValue)
+func ArrayOf[T any](xs []T, conv func(T) Value) Value {
+	arr := make(Array, len(xs))
+	for i, x := range xs {
+		arr[i] = conv(x)
+	}
+	return Value{X: arr}
+}
+
+// InlineValue returns an inline table value containing the given key-value
+// mappings, in order. The comments attached to the mappings are retained, but
+// are omitted when the table is rendered by String or by a default Formatter,
+// since a TOML v1.0 inline table cannot contain comments. A Formatter with
+// MultilineInline set writes them.
+func InlineValue(kvs ...*KeyValue) Value { return Value{X: Inline(slices.Clone(kvs))} }
+
+// ValueOf returns a value representing the Go value v, which must be one of
+// the following:
+//
+//   - A bool, or any integer or floating-point type.
+//   - A string, which is encoded as a basic string.
+//   - A time.Time, which is encoded as an offset date-time.
+//   - A slice or array of values of these types, encoded as an array.
+//   - A map with string keys and values of these types, encoded as an inline
+//     table with its keys in sorted order.
+//
+// A nil pointer or interface is not a valid value, but non-nil pointers and
+// interfaces are followed.  ValueOf reports an error for unsupported types.
+func ValueOf(v any) (Value, error) {
+	d, err := datumOf(reflect.ValueOf(v))
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{X: d}, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func datumOf(v reflect.Value) (Datum, error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, errors.New("nil value")
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, errors.New("nil value")
+	} else if v.Type() == timeType {
+		return TimeValue(v.Interface().(time.Time)).X, nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return BoolValue(v.Bool()).X, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return IntValue(v.Int()).X, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return Token{Type: scanner.Integer, text: strconv.FormatUint(v.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		return Token{Type: scanner.Float, text: formatFloat(v.Float(), v.Type().Bits())}, nil
+	case reflect.String:
+		return StringValue(v.String()).X, nil
+	case reflect.Slice, reflect.Array:
+		arr := make(Array, v.Len())
+		for i := range arr {
+			d, err := datumOf(v.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			arr[i] = Value{X: d}
+		}
+		return arr, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %v", v.Type().Key())
+		}
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(a.String(), b.String()) })
+		var in Inline
+		for _, key := range keys {
+			d, err := datumOf(v.MapIndex(key))
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", key.String(), err)
+			}
+			in = append(in, &KeyValue{Name: Key{key.String()}, Value: Value{X: d}})
+		}
+		return in, nil
+	}
+	return nil, fmt.Errorf("unsupported type %v", v.Type())
+}
+
+// formatFloat formats f as a TOML floating-point value, which must contain a
+// decimal point or exponent to be distinguished from an integer.
+func formatFloat(f float64, bits int) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, bits)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
 func (Value) isItem()      {}
 func (Value) isArrayItem() {}
 
 func (v Value) String() string { return v.X.String() }
 
+// Int returns the value of v, which must be an integer. See Token.Int.
+func (v Value) Int() (int64, error) {
+	t, err := v.token()
+	if err != nil {
+		return 0, err
+	}
+	return t.Int()
+}
+
+// Float returns the value of v, which must be a float. See Token.Float.
+func (v Value) Float() (float64, error) {
+	t, err := v.token()
+	if err != nil {
+		return 0, err
+	}
+	return t.Float()
+}
+
+// Bool returns the value of v, which must be a Boolean. See Token.Bool.
+func (v Value) Bool() (bool, error) {
+	t, err := v.token()
+	if err != nil {
+		return false, err
+	}
+	return t.Bool()
+}
+
+// Unquoted returns the content of v, which must be a string. See Token.Unquote.
+func (v Value) Unquoted() (string, error) {
+	t, err := v.token()
+	if err != nil {
+		return "", err
+	}
+	return t.Unquote()
+}
+
+// Equal reports whether v and w denote the same value. Unlike comparing their
+// text, Equal compares scalar values by their decoded content, so that for
+// example 1_000 equals 1000, and 'a' equals "a". Integers and floats are never
+// equal to each other, and all NaN values are equal. Date-times with offsets
+// are equal if they denote the same instant. Arrays are equal if their values
+// are pairwise equal, and inline tables are equal if they define the same keys
+// with equal values, in any order and whether or not they use dotted keys.
+// Comments, including those inside arrays, are not compared.
+func (v Value) Equal(w Value) bool { return datumsEqual(v.X, w.X) }
+
+func datumsEqual(a, b Datum) bool {
+	switch at := a.(type) {
+	case nil:
+		return b == nil
+	case Token:
+		bt, ok := b.(Token)
+		return ok && tokensEqual(at, bt)
+	case Array:
+		bt, ok := b.(Array)
+		if !ok {
+			return false
+		}
+		av, bv := at.Values(), bt.Values()
+		return slices.EqualFunc(av, bv, Value.Equal)
+	case Inline:
+		bt, ok := b.(Inline)
+		if !ok {
+			return false
+		}
+		am, bm := flattenInline(nil, at, nil), flattenInline(nil, bt, nil)
+		return maps.EqualFunc(am, bm, datumsEqual)
+	}
+	return false
+}
+
+// flattenInline adds the values of the mappings in t to m, keyed by the string
+// form of their complete keys with respect to base, descending into nested
+// inline tables, and returns m.
+func flattenInline(m map[string]Datum, t Inline, base Key) map[string]Datum {
+	if m == nil {
+		m = make(map[string]Datum)
+	}
+	for _, kv := range t {
+		key := append(append(Key(nil), base...), kv.Name...)
+		if in, ok := kv.Value.X.(Inline); ok && len(in) != 0 {
+			flattenInline(m, in, key)
+		} else {
+			m[key.String()] = kv.Value.X
+		}
+	}
+	return m
+}
+
+// tokenClass returns a label for the kind of value denoted by a token of type
+// t, such that tokens denoting comparable values have the same class.
+func tokenClass(t scanner.Token) scanner.Token {
+	switch t {
+	case scanner.MString, scanner.LString, scanner.MLString:
+		return scanner.String
+	}
+	return t
+}
+
+func tokensEqual(a, b Token) bool {
+	if tokenClass(a.Type) != tokenClass(b.Type) {
+		return false
+	}
+	switch a.Type {
+	case scanner.Integer:
+		x, xerr := a.Int()
+		y, yerr := b.Int()
+		return xerr == nil && yerr == nil && x == y
+	case scanner.Float:
+		x, xerr := a.Float()
+		y, yerr := b.Float()
+		return xerr == nil && yerr == nil && (x == y || math.IsNaN(x) && math.IsNaN(y))
+	case scanner.Word:
+		x, xerr := a.Bool()
+		y, yerr := b.Bool()
+		return xerr == nil && yerr == nil && x == y
+	case scanner.String, scanner.MString, scanner.LString, scanner.MLString:
+		x, xerr := a.Unquote()
+		y, yerr := b.Unquote()
+		return xerr == nil && yerr == nil && x == y
+	case scanner.DateTime, scanner.LocalDateTime, scanner.LocalDate, scanner.LocalTime:
+		x, xerr := a.Time()
+		y, yerr := b.Time()
+		return xerr == nil && yerr == nil && x.Equal(y)
+	}
+	return a.String() == b.String()
+}
+
+// token returns the token of v, or an error if v is an array or inline table.
+func (v Value) token() (Token, error) {
+	switch t := v.X.(type) {
+	case Token:
+		return t, nil
+	case Array:
+		return Token{}, errors.New("value is an array")
+	case Inline:
+		return Token{}, errors.New("value is an inline table")
+	}
+	return Token{}, errors.New("value is empty")
+}
+
 // WithComment returns a copy of v with its trailer set to text.
 func (v Value) WithComment(text string) Value { v.Trailer = text; return v }
 
@@ -238,6 +710,133 @@ func (t Token) String() string {
 	return t.Type.String()
 }
 
+// Unquote returns the content of a string token, with its quotes removed and
+// its escape sequences decoded. For a multi-line string, a newline just after
+// the opening delimiter is removed, as are line-ending backslashes and the
+// whitespace following them. It reports an error if t is not a string, or if
+// its escape sequences are invalid.
+func (t Token) Unquote() (string, error) {
+	text := t.text
+	switch t.Type {
+	case scanner.String:
+		dec, err := scanner.Unescape([]byte(text[1 : len(text)-1]))
+		return string(dec), err
+	case scanner.LString:
+		return text[1 : len(text)-1], nil
+	case scanner.MString:
+		body := trimFirstNewline(text[3 : len(text)-3])
+		dec, err := scanner.Unescape([]byte(trimContinuations(body)))
+		return string(dec), err
+	case scanner.MLString:
+		return trimFirstNewline(text[3 : len(text)-3]), nil
+	}
+	return "", fmt.Errorf("token is %v, not a string", t.Type)
+}
+
+// Int returns the value of an integer token. Hexadecimal, octal, and binary
+// prefixes and underscore separators are supported. It reports an error if t
+// is not an integer, or if its value does not fit in an int64.
+func (t Token) Int() (int64, error) {
+	if t.Type != scanner.Integer {
+		return 0, fmt.Errorf("token is %v, not an integer", t.Type)
+	}
+	return strconv.ParseInt(t.text, 0, 64)
+}
+
+// Float returns the value of a floating-point token, including the special
+// values inf and nan. It reports an error if t is not a float.
+func (t Token) Float() (float64, error) {
+	if t.Type != scanner.Float {
+		return 0, fmt.Errorf("token is %v, not a float", t.Type)
+	}
+	if strings.TrimLeft(t.text, "+-") == "nan" {
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(strings.ReplaceAll(t.text, "_", ""), 64)
+}
+
+// Bool returns the value of a Boolean token. It reports an error if t is not
+// a Boolean.
+func (t Token) Bool() (bool, error) {
+	if t.Type == scanner.Word {
+		switch t.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("token %q is not a Boolean", t.String())
+}
+
+// Time returns the value of a date or time token. An offset date-time has the
+// location of its UTC offset. Local dates and times, which have no offset, are
+// returned in UTC: A local date is returned as midnight at the start of that
+// date, and a local time is returned on January 1 of year 0, the zero date of
+// time.Parse. It reports an error if t is not a date or time, or if it does
+// not denote a valid date and time (for example, 2021-13-01).
+func (t Token) Time() (time.Time, error) {
+	layout, ok := TimeLayout(t.Type)
+	if !ok {
+		return time.Time{}, fmt.Errorf("token is %v, not a date or time", t.Type)
+	}
+	norm := strings.NewReplacer(" ", "T", "t", "T", "z", "Z").Replace(t.text)
+	return time.Parse(layout, norm)
+}
+
+// TimeLayout returns the layout, in the format of time.Parse, of date and time
+// tokens of type tok, and reports whether tok is a date or time type. The
+// layouts are the canonical forms based on RFC 3339, so formatting a time with
+// the layout for tok yields a valid literal of that type.
+func TimeLayout(tok scanner.Token) (string, bool) {
+	layout, ok := timeLayout[tok]
+	return layout, ok
+}
+
+// timeLayout maps date and time token types to their layouts.
+var timeLayout = map[scanner.Token]string{
+	scanner.DateTime:      time.RFC3339Nano,
+	scanner.LocalDateTime: "2006-01-02T15:04:05.999999999",
+	scanner.LocalDate:     time.DateOnly,
+	scanner.LocalTime:     "15:04:05.999999999",
+}
+
+// trimFirstNewline removes a newline immediately following the opening
+// delimiter of a multi-line string, which is not part of its content.
+func trimFirstNewline(s string) string {
+	if t, ok := strings.CutPrefix(s, "\r\n"); ok {
+		return t
+	}
+	return strings.TrimPrefix(s, "\n")
+}
+
+// trimContinuations removes each unescaped line-ending backslash from the body
+// of a multi-line basic string, together with all the whitespace and newlines
+// that follow it.
+func trimContinuations(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			sb.WriteByte(s[i])
+			continue
+		}
+		rest := strings.TrimLeft(s[i+1:], " \t")
+		if strings.HasPrefix(rest, "\n") || strings.HasPrefix(rest, "\r\n") {
+			rest = strings.TrimLeft(rest, " \t\r\n")
+			i = len(s) - len(rest) - 1
+			continue
+		}
+		// An ordinary escape; copy it and the escaped character together so an
+		// escaped backslash is not mistaken for a continuation.
+		sb.WriteByte('\\')
+		if i+1 < len(s) {
+			i++
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
 // An ArrayItem is an element in a TOML array value. The concrete type of an
 // ArrayItem is one of Comments or Value.
 type ArrayItem interface {
@@ -249,17 +848,120 @@ type Array []ArrayItem
 
 func (Array) isDatum() {}
 
+// String renders a as TOML. If a contains comments, including trailing
+// comments on its values, or a nested value that spans multiple lines, it is
+// rendered with one element per line so that the comments are preserved.
+// Nested values are indented by two spaces per level.
 func (a Array) String() string {
+	var sb strings.Builder
+	writeArray(&sb, a, "")
+	return sb.String()
+}
+
+// writeArray writes a to sb. The first line is not indented, but subsequent
+// lines are indented by prefix.
+func writeArray(sb *strings.Builder, a Array, prefix string) {
 	if len(a) == 0 {
-		return "[]"
+		sb.WriteString("[]")
+		return
+	}
+	if !a.isMultiline() {
+		sb.WriteString("[")
+		for i, elt := range a {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			writeDatum(sb, elt.(Value).X, prefix)
+		}
+		sb.WriteString("]")
+		return
 	}
-	var elts []string
+	inner := prefix + "  "
+	sb.WriteString("[\n")
+	for _, elt := range a {
+		switch t := elt.(type) {
+		case Comments:
+			for _, line := range t.Clean() {
+				fmt.Fprintf(sb, "%s%s\n", inner, line)
+			}
+		case Value:
+			sb.WriteString(inner)
+			writeDatum(sb, t.X, inner)
+			sb.WriteString(",")
+			if t.Trailer != "" {
+				fmt.Fprintf(sb, "  %s", CleanTrailer(t.Trailer))
+			}
+			sb.WriteString("\n")
+		}
+	}
+	sb.WriteString(prefix + "]")
+}
+
+// writeDatum writes d to sb. The first line is not indented, but subsequent
+// lines of a compound value are indented by prefix.
+func writeDatum(sb *strings.Builder, d Datum, prefix string) {
+	switch t := d.(type) {
+	case Array:
+		writeArray(sb, t, prefix)
+	case Inline:
+		writeInline(sb, t, prefix)
+	default:
+		sb.WriteString(d.String())
+	}
+}
+
+// isMultiline reports whether a must be rendered with one element per line,
+// because it contains comments or a nested value that does.
+func (a Array) isMultiline() bool {
+	for _, elt := range a {
+		if v, ok := elt.(Value); !ok || v.Trailer != "" || isMultilineDatum(v.X) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMultilineDatum reports whether d is a compound value that spans multiple
+// lines when rendered, to preserve its comments or those of a nested value.
+func isMultilineDatum(d Datum) bool {
+	switch t := d.(type) {
+	case Array:
+		return t.isMultiline()
+	case Inline:
+		return t.isMultiline()
+	}
+	return false
+}
+
+// Values returns the values in a, omitting comments.
+func (a Array) Values() []Value {
+	var out []Value
 	for _, elt := range a {
 		if v, ok := elt.(Value); ok {
-			elts = append(elts, v.String())
+			out = append(out, v)
 		}
 	}
-	return `[` + strings.Join(elts, ", ") + `]`
+	return out
+}
+
+// Append adds v to the end of a.
+func (a *Array) Append(v Value) { *a = append(*a, v) }
+
+// RemoveIndex removes the value at offset i among the values of a, as
+// reported by Values. Comments in a are not affected. It panics if i is out of
+// range.
+func (a *Array) RemoveIndex(i int) {
+	n := 0
+	for j, elt := range *a {
+		if _, ok := elt.(Value); !ok {
+			continue
+		} else if n == i {
+			*a = slices.Delete(*a, j, j+1)
+			return
+		}
+		n++
+	}
+	panic(fmt.Sprintf("array index %d out of range [0:%d]", i, n))
 }
 
 // An Inline represents a (possibly empty) inline table value.
@@ -267,14 +969,76 @@ type Inline []*KeyValue
 
 func (Inline) isDatum() {}
 
+// String renders t as TOML. The braces and entries of t are written on a
+// single line, as the TOML v1.0 specification requires, so any comments
+// attached to the entries of t are omitted. Only nested values that span
+// multiple lines are broken, indented by two spaces per level. To preserve
+// the comments, use a tomledit.Formatter with MultilineInline set.
 func (t Inline) String() string {
+	var sb strings.Builder
+	writeInline(&sb, t, "")
+	return sb.String()
+}
+
+// writeInline writes t to sb. The first line is not indented, but subsequent
+// lines are indented by prefix.
+func writeInline(sb *strings.Builder, t Inline, prefix string) {
 	if len(t) == 0 {
-		return "{}"
+		sb.WriteString("{}")
+		return
 	}
-
-	elts := make([]string, len(t))
+	sb.WriteString("{")
 	for i, elt := range t {
-		elts[i] = elt.String()
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(elt.Name.String() + " = ")
+		writeDatum(sb, elt.Value.X, prefix)
+	}
+	sb.WriteString("}")
+}
+
+// isMultiline reports whether t spans multiple lines when rendered, because
+// it contains a nested value that does.
+func (t Inline) isMultiline() bool {
+	for _, kv := range t {
+		if isMultilineDatum(kv.Value.X) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasComments reports whether any of the entries of t has a block comment, a
+// trailing comment, or a tail comment. Nested values are not considered.
+func (t Inline) HasComments() bool {
+	for _, kv := range t {
+		if len(kv.Block) != 0 || kv.Value.Trailer != "" || len(kv.Tail) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the mapping in t whose key is the single segment name, or nil
+// if there is no such mapping.
+func (t Inline) Find(name string) *KeyValue {
+	for _, kv := range t {
+		if len(kv.Name) == 1 && kv.Name[0] == name {
+			return kv
+		}
+	}
+	return nil
+}
+
+// Set sets the value of the mapping in t whose key is the single segment name
+// to v, and reports whether the mapping already existed. If it did not, a new
+// mapping is added to the end of t.
+func (t *Inline) Set(name string, v Value) bool {
+	if kv := t.Find(name); kv != nil {
+		kv.Value = v
+		return true
 	}
-	return `{` + strings.Join(elts, ", ") + `}`
+	*t = append(*t, &KeyValue{Name: Key{name}, Value: v})
+	return false
 }
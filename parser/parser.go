@@ -10,6 +10,7 @@ package parser
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -20,25 +21,137 @@ import (
 // A Parser is a parser for TOML syntax.
 type Parser struct {
 	sc *scanner.Scanner
+
+	// If true, accept the words "true", "false", "on", "off", "yes", and "no"
+	// in any combination of upper- and lower-case as Boolean values.  These are
+	// normalized to "true" and "false" in the resulting values.  By default
+	// only "true" and "false" are accepted, as the TOML specification requires.
+	LenientBooleans bool
+
+	// If true, accept a trailing comma after the last entry of a non-empty
+	// inline table, as permitted by the TOML v1.1 draft.  By default a trailing
+	// comma is an error, as the TOML v1.0 specification requires.
+	InlineTrailingComma bool
+
+	// If true, accept line breaks and comments between the entries of an
+	// inline table, as permitted by the TOML v1.1 draft. A block of comments
+	// before an entry is attached to that entry, and a comment on the same
+	// line as an entry is its trailing comment. A block of comments after the
+	// last entry, before the closing brace, is the Tail of that entry.
+	// Comments in an inline table with no entries are reported as an error,
+	// since there is no entry to attach them to. A trailing comma after the
+	// last entry is also accepted, as for InlineTrailingComma. By default, an
+	// inline table must be written on a single line without comments, as the
+	// TOML v1.0 specification requires.
+	MultilineInline bool
+
+	lines       []LineRange // line ranges of items returned by Items
+	first, last int         // lines of the first and last tokens of the current item
+}
+
+// A LineRange is a range of input lines, 1-based and inclusive.
+type LineRange struct {
+	First, Last int
 }
 
 // New constructs a new parser that consumes input from r.
 func New(r io.Reader) *Parser { return &Parser{sc: scanner.New(r)} }
 
-// Items reads the top-level items from the input.
+// Items reads the top-level items from the input.  If an error occurs, Items
+// returns the items successfully parsed prior to the error, along with the
+// error.
 func (p *Parser) Items() ([]Item, error) {
 	var items []Item
+	err := p.Each(func(item Item) error {
+		items = append(items, item)
+		p.lines = append(p.lines, LineRange{First: p.first, Last: p.last})
+		return nil
+	})
+	return items, err
+}
+
+// ErrStopScan is a sentinel error that a callback to Each may return to stop
+// parsing without error.
+var ErrStopScan = errors.New("stop scanning")
+
+// Each reads the top-level items from the input and calls fn for each item in
+// order as it is parsed, without retaining the items. If fn reports an error,
+// Each stops and returns that error, except that if the error is ErrStopScan,
+// Each returns nil. Otherwise, Each returns nil at the end of the input, or
+// the first syntax error.
+func (p *Parser) Each(fn func(Item) error) error {
 	for {
+		p.first, p.last = 0, 0
 		item, err := p.parseItem()
 		if err == io.EOF {
-			return items, nil
+			return nil
 		} else if err != nil {
-			return nil, err
+			return p.parseError(err)
 		}
-		items = append(items, item)
+		if err := fn(item); err == ErrStopScan {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// ItemLines returns the ranges of input lines spanned by the items returned by
+// Items, in the same order. The range of an item includes its block comment
+// and trailing comment, if any, but not any blank lines around it. Ranges are
+// not recorded by Each.
+func (p *Parser) ItemLines() []LineRange { return p.lines }
+
+// A ParseError is the concrete type of errors reported by Items. It records the
+// location in the input where the error was detected.
+type ParseError struct {
+	Line   int    // line number, 1-based
+	Column int    // byte offset of column in line, 0-based
+	Text   string // the text of the offending token, if any
+	Err    error  // the underlying error
+}
+
+func (e *ParseError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error of e.
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// position returns the input position of the current token.
+func (p *Parser) position() Position {
+	loc := p.sc.Location()
+	return Position{Line: loc.First.Line, Column: loc.First.Column, Offset: loc.Span.Pos}
+}
+
+// parseError wraps err in a *ParseError at the current scanner location.
+func (p *Parser) parseError(err error) error {
+	loc := p.sc.Location().First
+	return &ParseError{
+		Line:   loc.Line,
+		Column: loc.Column,
+		Text:   string(p.sc.Text()),
+		Err:    err,
 	}
 }
 
+// next advances the scanner, recording the lines spanned by the tokens of the
+// current item.
+func (p *Parser) next() error {
+	if err := p.sc.Next(); err != nil {
+		return err
+	}
+	if tok := p.sc.Token(); tok != scanner.Newline {
+		loc := p.sc.Location()
+		if p.first == 0 {
+			p.first = loc.First.Line
+		}
+		p.last = loc.Last.Line
+		if tok == scanner.Comment {
+			p.last = loc.First.Line // the location of a comment includes its newline
+		}
+	}
+	return nil
+}
+
 // parseItem parses a single top-level item in a TOML file.
 // The concrete type of Item will be Comments, Heading, or KeyValue.
 //
@@ -47,7 +160,8 @@ func (p *Parser) Items() ([]Item, error) {
 // attached to the item itself.
 func (p *Parser) parseItem() (Item, error) {
 	var block []string
-	for p.sc.Next() == nil {
+	var blank bool // whether a blank line preceded the item
+	for p.next() == nil {
 		switch p.sc.Token() {
 		case scanner.Comment:
 			block = append(block, string(p.sc.Text()))
@@ -57,6 +171,7 @@ func (p *Parser) parseItem() (Item, error) {
 			if len(block) != 0 {
 				return Comments(block), nil
 			}
+			blank = true
 			continue
 
 		case scanner.LBracket:
@@ -66,7 +181,11 @@ func (p *Parser) parseItem() (Item, error) {
 			scanner.String, scanner.LString,
 			scanner.Integer, scanner.Float,
 			scanner.LocalDate:
-			return p.parseKeyValue(p.sc.Token(), block)
+			kv, err := p.parseKeyValue(p.sc.Token(), block)
+			if kv != nil {
+				kv.BlankBefore = blank
+			}
+			return kv, err
 
 		default:
 			return nil, fmt.Errorf("at %s: unexpected %v", p.sc.Location().First, p.sc.Token())
@@ -80,6 +199,7 @@ func (p *Parser) parseItem() (Item, error) {
 
 // parseHeading parses the heading of a table ("[name]") or table-array ("[[name]]").
 func (p *Parser) parseHeading(tok scanner.Token, comments []string) (*Heading, error) {
+	pos := p.position()
 	var isArray bool
 	if next, err := p.require(); err != nil {
 		return nil, err
@@ -112,6 +232,7 @@ func (p *Parser) parseHeading(tok scanner.Token, comments []string) (*Heading, e
 		IsArray: isArray,
 		Name:    key,
 		Line:    line,
+		Pos:     pos,
 	}
 
 	// Check for an optional trailing comment.
@@ -123,6 +244,7 @@ func (p *Parser) parseHeading(tok scanner.Token, comments []string) (*Heading, e
 
 // parseInlineKeyValue parses an undecorated key-value assignment.
 func (p *Parser) parseInlineKeyValue(tok scanner.Token) (*KeyValue, error) {
+	pos := p.position()
 	key, line, err := p.parseKey()
 	if err != nil {
 		return nil, err
@@ -134,7 +256,7 @@ func (p *Parser) parseInlineKeyValue(tok scanner.Token) (*KeyValue, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &KeyValue{Name: key, Value: val, Line: line}, nil
+	return &KeyValue{Name: key, Value: val, Line: line, Pos: pos}, nil
 }
 
 // parseKeyValue parses a key-value assignment ("name = value").
@@ -165,7 +287,14 @@ func (p *Parser) parseKey() (Key, int, error) {
 			line = p.sc.Location().First.Line
 		}
 		switch p.sc.Token() {
-		case scanner.Word, scanner.Integer, scanner.LocalDate:
+		case scanner.Integer:
+			// Digit-only keys are scanned as integers, but a sign is not allowed.
+			if text[0] == '+' {
+				return nil, 0, fmt.Errorf(`at %s: invalid %q in key`, p.sc.Location().First, text[0])
+			}
+			result = append(result, string(text))
+
+		case scanner.Word, scanner.LocalDate:
 			result = append(result, string(text))
 
 		case scanner.String:
@@ -217,6 +346,9 @@ func (p *Parser) parseValue() (Value, error) {
 	if next.IsValue() {
 		// Special case: Bare words are not allowed except true and false.
 		text := string(p.sc.Text())
+		if next == scanner.Word && p.LenientBooleans {
+			text = lenientBool(text)
+		}
 		if next == scanner.Word && text != "true" && text != "false" {
 			return Value{}, fmt.Errorf("at %s: got %v (%q), wanted value, array, or inline table",
 				p.sc.Location().First, next, text)
@@ -304,29 +436,68 @@ func (p *Parser) parseArrayValue() (Array, error) {
 // parsesInlineValue parses an inline table. The starting token must be the
 // opening "{" for the table.
 func (p *Parser) parseInlineValue() (Inline, error) {
-	if next, err := p.require(); err != nil {
-		return nil, err
-	} else if next == scanner.RInline {
-		return nil, nil // OK, empty
-	}
-
+	var block []string
 	var result Inline
+	var itemLine int
+	var wantComma bool
 	for {
-		kv, err := p.parseInlineKeyValue(p.sc.Token())
-		if err != nil {
+		next, err := p.require()
+		if err == io.EOF {
+			return nil, fmt.Errorf("at %v: unclosed inline table", p.sc.Location().First)
+		} else if err != nil {
 			return nil, err
 		}
-		result = append(result, kv)
-
-		// Unlike arrays, inline tables do not permit trailing commas.
-		if next, err := p.require(scanner.Comma, scanner.RInline); err != nil {
-			return nil, err
-		} else if next == scanner.RInline {
+		if (next == scanner.Newline || next == scanner.Comment) && !p.MultilineInline {
+			return nil, fmt.Errorf("at %v: got %v, wanted %v",
+				p.sc.Location().First, next, tokLabel([]scanner.Token{scanner.Comma, scanner.RInline}))
+		}
+		switch next {
+		case scanner.RInline:
+			if len(block) != 0 {
+				// Comments after the last entry are attached to it. If there
+				// are no entries, there is nowhere to keep them.
+				if len(result) == 0 {
+					return nil, fmt.Errorf("at %v: comment in an empty inline table", p.sc.Location().First)
+				}
+				result[len(result)-1].Tail = Comments(block)
+			}
+			if len(result) != 0 && !wantComma && !p.InlineTrailingComma && !p.MultilineInline {
+				return nil, fmt.Errorf("at %v: unexpected %v after the last entry", p.sc.Location().First, scanner.Comma)
+			}
 			return result, nil
-		} else if _, err := p.require(); err != nil {
-			return nil, err
+
+		case scanner.Comment:
+			// As in an array, a comment on the same line as the previous entry
+			// is its trailer, even if it follows a comma.
+			if p.sc.Location().First.Line == itemLine {
+				result[len(result)-1].Value.Trailer = string(p.sc.Text())
+			} else {
+				block = append(block, string(p.sc.Text()))
+			}
+
+		case scanner.Newline:
+			// OK, permitted by MultilineInline
+
+		case scanner.Comma:
+			if !wantComma {
+				return nil, fmt.Errorf("at %v: unexpected %v", p.sc.Location().First, scanner.Comma)
+			}
+			wantComma = false
+
+		default:
+			if wantComma {
+				return nil, fmt.Errorf("at %v: got %v, want %v", p.sc.Location().First, next, scanner.Comma)
+			}
+			kv, err := p.parseInlineKeyValue(next)
+			if err != nil {
+				return nil, err
+			}
+			kv.Block = Comments(block)
+			block = nil
+			itemLine = p.sc.Location().Last.Line
+			wantComma = true
+			result = append(result, kv)
 		}
-		// Reaching here, we saw a comma; go for another value.
 	}
 }
 
@@ -335,7 +506,7 @@ func (p *Parser) parseInlineValue() (Inline, error) {
 // type must equal one of them or an error is reported naming those tokens;
 // otherwise any token type is accepted.
 func (p *Parser) require(tokens ...scanner.Token) (scanner.Token, error) {
-	if err := p.sc.Next(); err != nil {
+	if err := p.next(); err != nil {
 		return scanner.Invalid, err
 	} else if len(tokens) != 0 {
 		got := p.sc.Token()
@@ -356,12 +527,24 @@ func (p *Parser) require(tokens ...scanner.Token) (scanner.Token, error) {
 func (p *Parser) advance(tok scanner.Token) (scanner.Token, error) {
 	if got := p.sc.Token(); got != tok {
 		return tok, fmt.Errorf("at %s: got %v, wanted %v", p.sc.Location().First, got, tok)
-	} else if err := p.sc.Next(); err != nil {
+	} else if err := p.next(); err != nil {
 		return scanner.Invalid, err
 	}
 	return p.sc.Token(), nil
 }
 
+// lenientBool returns the normalized spelling of a non-standard Boolean word,
+// or returns text unchanged if it is not one.
+func lenientBool(text string) string {
+	switch strings.ToLower(text) {
+	case "true", "on", "yes":
+		return "true"
+	case "false", "off", "no":
+		return "false"
+	}
+	return text
+}
+
 // tokLabel makes a human-readable summary string for the given token types.
 func tokLabel(tokens []scanner.Token) string {
 	if len(tokens) == 0 {
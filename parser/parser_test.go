@@ -3,12 +3,16 @@
 package parser_test
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/creachadair/tomledit/parser"
+	"github.com/creachadair/tomledit/scanner"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -66,9 +70,10 @@ func TestItems(t *testing.T) {
 		// - Arrays.
 		{"x=[]", []result{{keyValueType, `x = []`}}},
 		{"x=[\n5,\n\"c\",\n]\n", []result{{keyValueType, `x = [5, "c"]`}}},
-		{"x = [\n# ignored\n1,2,3\n# ignored\n, ]\n", []result{{keyValueType, `x = [1, 2, 3]`}}},
+		{"x = [\n# kept\n1,2,3\n# kept\n, ]\n", []result{{keyValueType, "x = [\n  # kept\n  1,\n  2,\n  3,\n  # kept\n]"}}},
 		{"x = [[]] # array in array", []result{{keyValueType, `x = [[]]`}}},
-		{"x = [[],[[[[],5 # ok\n]],[]],] # array in array", []result{{keyValueType, `x = [[], [[[[], 5]], []]]`}}},
+		{"x = [[],[[[[],5 # ok\n]],[]],] # array in array", []result{{keyValueType,
+			"x = [\n  [],\n  [\n    [\n      [\n        [],\n        5,  # ok\n      ],\n    ],\n    [],\n  ],\n]"}}},
 
 		// - Inline tables.
 		{"x={} # whatever, bro\n", []result{{keyValueType, `x = {}`}}},
@@ -228,6 +233,30 @@ contributors = [
 	})
 }
 
+func TestItemLines(t *testing.T) {
+	const input = `
+# free comment
+
+# block
+a = 1  # trailer
+b = [
+  1, # one
+  2,
+]
+[c] # heading
+d = """x
+y"""
+`
+	p := parser.New(strings.NewReader(input))
+	if _, err := p.Items(); err != nil {
+		t.Fatalf("Items: unexpected error: %v", err)
+	}
+	want := []parser.LineRange{{2, 2}, {4, 5}, {6, 9}, {10, 10}, {11, 12}}
+	if diff := cmp.Diff(want, p.ItemLines()); diff != "" {
+		t.Errorf("ItemLines: (-want, +got)\n%s", diff)
+	}
+}
+
 func TestParseKey(t *testing.T) {
 	t.Run("Good", func(t *testing.T) {
 		const input = ` a . "b.c d" . e`
@@ -240,8 +269,38 @@ func TestParseKey(t *testing.T) {
 		}
 	})
 
+	t.Run("Numeric", func(t *testing.T) {
+		tests := []struct {
+			input string
+			want  parser.Key
+		}{
+			{"0", parser.Key{"0"}},
+			{"007", parser.Key{"007"}},
+			{"1234", parser.Key{"1234"}},
+			{"-5", parser.Key{"-5"}},
+			{"1_000", parser.Key{"1_000"}},
+			{"table.1", parser.Key{"table", "1"}},
+			{"a.007.0", parser.Key{"a", "007", "0"}},
+			{"00.07", parser.Key{"00", "07"}},
+			{"2021-01-01", parser.Key{"2021-01-01"}},
+		}
+		for _, test := range tests {
+			key, err := parser.ParseKey(test.input)
+			if err != nil {
+				t.Errorf("ParseKey(%q): %v", test.input, err)
+				continue
+			}
+			if diff := cmp.Diff(test.want, key); diff != "" {
+				t.Errorf("ParseKey(%q): (-want, +got)\n%s", test.input, diff)
+			}
+			if got := key.String(); got != test.input {
+				t.Errorf("Key %q: got %q, want %q", key, got, test.input)
+			}
+		}
+	})
+
 	t.Run("Bad", func(t *testing.T) {
-		for _, in := range []string{"", "  ", `#nope`, `.garbage`, `extra stuff`} {
+		for _, in := range []string{"", "  ", `#nope`, `.garbage`, `extra stuff`, `+1`, `a.+1`} {
 			key, err := parser.ParseKey(in)
 			if err == nil {
 				t.Errorf("ParseKey(%q): got %v, wanted error", in, key)
@@ -250,6 +309,54 @@ func TestParseKey(t *testing.T) {
 	})
 }
 
+func TestParseItem(t *testing.T) {
+	t.Run("Good", func(t *testing.T) {
+		tests := []struct {
+			input, want string
+		}{
+			{"a = 1", "a = 1"},
+			{"# note\na.b = 'x' # tail\n", "a.b = 'x'"},
+			{"[x.y]", "[x.y]"},
+			{"\n[[p]] # arr\n\n", "[[p]]"},
+			{"# a\n# b\n", "# a\n# b"},
+		}
+		for _, test := range tests {
+			item, err := parser.ParseItem(test.input)
+			if err != nil {
+				t.Errorf("ParseItem(%q): unexpected error: %v", test.input, err)
+				continue
+			}
+			if got := fmt.Sprint(item); got != test.want {
+				t.Errorf("ParseItem(%q): got %q, want %q", test.input, got, test.want)
+			}
+		}
+	})
+	t.Run("Comments", func(t *testing.T) {
+		item, err := parser.ParseItem("# note\nx = true # tail")
+		if err != nil {
+			t.Fatalf("ParseItem: unexpected error: %v", err)
+		}
+		kv, ok := item.(*parser.KeyValue)
+		if !ok {
+			t.Fatalf("ParseItem: got %T, want *KeyValue", item)
+		}
+		if diff := cmp.Diff(parser.Comments{"# note"}, kv.Block); diff != "" {
+			t.Errorf("Block (-want, +got):\n%s", diff)
+		}
+		if got, want := kv.Value.Trailer, "# tail"; got != want {
+			t.Errorf("Trailer: got %q, want %q", got, want)
+		}
+	})
+	t.Run("Bad", func(t *testing.T) {
+		for _, in := range []string{"", "\n\n", "a = ", "a = 1\nb = 2", "[x]\ny = 3", "# c\n\nz = 1", "= 5"} {
+			item, err := parser.ParseItem(in)
+			if err == nil {
+				t.Errorf("ParseItem(%q): got %v, wanted error", in, item)
+			}
+		}
+	})
+}
+
 func TestKeyCompare(t *testing.T) {
 	tests := []struct {
 		lhs, rhs   string
@@ -291,6 +398,68 @@ func TestKeyCompare(t *testing.T) {
 	}
 }
 
+func TestKeyBeforeNatural(t *testing.T) {
+	tests := []struct {
+		lhs, rhs string
+		want     bool
+	}{
+		{"a", "a", false},
+		{"a", "b", true},
+		{"node2", "node10", true},
+		{"node10", "node2", false},
+		{"node10", "node10", false},
+		{"node02", "node2", false},
+		{"node2", "node02", true},
+		{"node2", "node2a", true},
+		{"v1.x10", "v1.x9", false},
+		{"v1.x9", "v1.x10", true},
+		{"v2", "v10.a", true},
+		{"a.b", "a.b.c", true},
+		{"a2b10", "a2b9", false},
+		{"10", "9a", false},
+		{"9a", "10", true},
+	}
+	for _, test := range tests {
+		lhs := mustParseKey(t, test.lhs)
+		rhs := mustParseKey(t, test.rhs)
+		if got := lhs.BeforeNatural(rhs); got != test.want {
+			t.Errorf("(%q).BeforeNatural(%q): got %v, want %v", lhs, rhs, got, test.want)
+		}
+	}
+}
+
+func TestKeyChildParent(t *testing.T) {
+	base := make(parser.Key, 2, 10)
+	copy(base, []string{"a", "b"})
+
+	c1 := base.Child("c")
+	c2 := base.Child("d", "e")
+	if got, want := c1.String(), "a.b.c"; got != want {
+		t.Errorf("Child(c): got %q, want %q", got, want)
+	}
+	if got, want := c2.String(), "a.b.d.e"; got != want {
+		t.Errorf("Child(d, e): got %q, want %q", got, want)
+	}
+	if got, want := base.Child().String(), "a.b"; got != want {
+		t.Errorf("Child(): got %q, want %q", got, want)
+	}
+
+	p := c2.Parent()
+	if got, want := p.String(), "a.b.d"; got != want {
+		t.Errorf("Parent: got %q, want %q", got, want)
+	}
+	_ = append(p, "x")
+	if got, want := c2.String(), "a.b.d.e"; got != want {
+		t.Errorf("After append to parent: got %q, want %q", got, want)
+	}
+	if got := (parser.Key{"a"}).Parent(); len(got) != 0 {
+		t.Errorf("Parent of a: got %q, want empty", got)
+	}
+	if got := parser.Key(nil).Parent(); got != nil {
+		t.Errorf("Parent of nil: got %q, want nil", got)
+	}
+}
+
 func TestParseValue(t *testing.T) {
 	tests := []struct {
 		input, want, comment string
@@ -322,6 +491,137 @@ func TestParseValue(t *testing.T) {
 	}
 }
 
+func TestScalarConstructors(t *testing.T) {
+	when := time.Date(2024, 3, 1, 12, 30, 0, 500_000_000, time.FixedZone("X", -7*3600))
+	tests := []struct {
+		input parser.Value
+		want  string
+	}{
+		{parser.IntValue(0), `0`},
+		{parser.IntValue(-1234), `-1234`},
+		{parser.FloatValue(1), `1.0`},
+		{parser.FloatValue(-0.25), `-0.25`},
+		{parser.FloatValue(1e300), `1e+300`},
+		{parser.FloatValue(math.Inf(-1)), `-inf`},
+		{parser.FloatValue(math.NaN()), `nan`},
+		{parser.BoolValue(true), `true`},
+		{parser.BoolValue(false), `false`},
+		{parser.StringValue(""), `""`},
+		{parser.StringValue(`say "hi"\` + "\n"), `"say \"hi\"\\\n"`},
+		{parser.TimeValue(when), `2024-03-01T12:30:00.5-07:00`},
+	}
+	for _, tc := range tests {
+		if got := tc.input.String(); got != tc.want {
+			t.Errorf("Value: got %#q, want %#q", got, tc.want)
+		}
+
+		// The text of the value should parse back to an equal value.
+		v, err := parser.ParseValue(tc.want)
+		if err != nil {
+			t.Errorf("ParseValue(%#q): unexpected error: %v", tc.want, err)
+		} else if !v.Equal(tc.input) {
+			t.Errorf("ParseValue(%#q): got %v, want %v", tc.want, v, tc.input)
+		}
+	}
+	if s, err := parser.StringValue("a\tb").Unquoted(); err != nil || s != "a\tb" {
+		t.Errorf("StringValue Unquoted: got %q, %v; want %q", s, err, "a\tb")
+	}
+}
+
+func TestArrayConstructors(t *testing.T) {
+	tests := []struct {
+		input parser.Value
+		want  string
+	}{
+		{parser.ArrayValue(), `[]`},
+		{parser.ArrayValue(parser.IntValue(1), parser.StringValue("x")), `[1, "x"]`},
+		{parser.ArrayValue(parser.ArrayValue(parser.BoolValue(true))), `[[true]]`},
+		{parser.ArrayOf([]int64{1, 2, 3}, parser.IntValue), `[1, 2, 3]`},
+		{parser.ArrayOf([]string{`a"`, "b"}, parser.StringValue), `["a\"", "b"]`},
+		{parser.ArrayOf(nil, parser.FloatValue), `[]`},
+		{parser.ArrayOf([]int{1, 2}, func(z int) parser.Value {
+			return parser.IntValue(int64(z * z))
+		}), `[1, 4]`},
+	}
+	for _, tc := range tests {
+		if got := tc.input.String(); got != tc.want {
+			t.Errorf("Value: got %#q, want %#q", got, tc.want)
+		}
+	}
+}
+
+func TestInlineValue(t *testing.T) {
+	tests := []struct {
+		input parser.Value
+		want  string
+	}{
+		{parser.InlineValue(), `{}`},
+		{parser.InlineValue(
+			&parser.KeyValue{Name: parser.Key{"a"}, Value: parser.IntValue(1)},
+			&parser.KeyValue{Name: parser.Key{"b", "c d"}, Value: parser.StringValue("x")},
+		), `{a = 1, b."c d" = "x"}`},
+		{parser.InlineValue(
+			&parser.KeyValue{Name: parser.Key{"p"}, Value: parser.InlineValue(
+				&parser.KeyValue{Name: parser.Key{"q"}, Value: parser.ArrayOf([]bool{true}, parser.BoolValue)},
+			)},
+		), `{p = {q = [true]}}`},
+		{parser.InlineValue(
+			&parser.KeyValue{Block: parser.Comments{"# about a"}, Name: parser.Key{"a"},
+				Value: parser.Value{X: parser.IntValue(1).X, Trailer: "# one"}},
+		), `{a = 1}`},
+	}
+	for _, tc := range tests {
+		if got := tc.input.String(); got != tc.want {
+			t.Errorf("Value: got %#q, want %#q", got, tc.want)
+		}
+	}
+}
+
+func TestValueOf(t *testing.T) {
+	type str string
+	n := 5
+	tests := []struct {
+		input any
+		want  string
+	}{
+		{true, "true"},
+		{-12, "-12"},
+		{uint8(200), "200"},
+		{&n, "5"},
+		{1.0, "1.0"},
+		{float32(0.25), "0.25"},
+		{1e21, "1e+21"},
+		{math.Inf(-1), "-inf"},
+		{math.NaN(), "nan"},
+		{"a \"b\"\n", `"a \"b\"\n"`},
+		{str("x"), `"x"`},
+		{time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC), "2022-01-02T03:04:05Z"},
+		{[]any{1, "two", []int{3}}, `[1, "two", [3]]`},
+		{[2]bool{true, false}, "[true, false]"},
+		{map[string]any{"b": 2, "a": map[string]int{"c": 3}}, "{a = {c = 3}, b = 2}"},
+		{map[string]int{}, "{}"},
+	}
+	for _, test := range tests {
+		v, err := parser.ValueOf(test.input)
+		if err != nil {
+			t.Errorf("ValueOf(%#v): unexpected error: %v", test.input, err)
+			continue
+		}
+		if got := v.String(); got != test.want {
+			t.Errorf("ValueOf(%#v): got %s, want %s", test.input, got, test.want)
+		}
+		if _, err := parser.ParseValue(v.String()); err != nil {
+			t.Errorf("ParseValue(%q): %v", v, err)
+		}
+	}
+
+	for _, bad := range []any{nil, (*int)(nil), struct{}{}, map[int]int{1: 1}, []any{nil}, make(chan int)} {
+		if v, err := parser.ValueOf(bad); err == nil {
+			t.Errorf("ValueOf(%#v): got %v, want error", bad, v)
+		}
+	}
+}
+
 func TestCleanTrailer(t *testing.T) {
 	tests := []struct {
 		input, want string
@@ -355,3 +655,475 @@ func mustParseKey(t *testing.T, s string) parser.Key {
 	}
 	return k
 }
+
+func TestLenientBooleans(t *testing.T) {
+	const input = "a = True\nb = FALSE\nc = [on, Off, yes, NO]\nd = {e = tRuE}\n"
+	if _, err := parser.New(strings.NewReader(input)).Items(); err == nil {
+		t.Error("Items: got nil error for non-standard Booleans")
+	}
+
+	p := parser.New(strings.NewReader(input))
+	p.LenientBooleans = true
+	items, err := p.Items()
+	if err != nil {
+		t.Fatalf("Items: unexpected error: %v", err)
+	}
+	var got []string
+	for _, item := range items {
+		got = append(got, fmt.Sprint(item))
+	}
+	want := []string{
+		"a = true",
+		"b = false",
+		"c = [true, false, true, false]",
+		"d = {e = true}",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Items: (-want, +got)\n%s", diff)
+	}
+
+	// Other bare words are still not accepted.
+	p = parser.New(strings.NewReader("a = maybe"))
+	p.LenientBooleans = true
+	if items, err := p.Items(); err == nil {
+		t.Errorf("Items: got %v, wanted error", items)
+	}
+}
+
+func TestInlineTrailingComma(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string // empty if an error is expected
+		lenient bool
+	}{
+		{"x = {}", "x = {}", false},
+		{"x = {}", "x = {}", true},
+		{"x = {a=1}", "x = {a = 1}", false},
+		{"x = {a=1,}", "", false},
+		{"x = {a=1,}", "x = {a = 1}", true},
+		{"x = {a=1, b={c=2,},}", "x = {a = 1, b = {c = 2}}", true},
+		{"x = {,}", "", true},
+		{"x = {a=1,,}", "", true},
+	}
+	for _, test := range tests {
+		p := parser.New(strings.NewReader(test.input))
+		p.InlineTrailingComma = test.lenient
+		items, err := p.Items()
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("Items %q (lenient=%v): got %v, wanted error", test.input, test.lenient, items)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Items %q (lenient=%v): unexpected error: %v", test.input, test.lenient, err)
+			continue
+		}
+		if got := fmt.Sprint(items[0]); got != test.want {
+			t.Errorf("Items %q (lenient=%v): got %q, want %q", test.input, test.lenient, got, test.want)
+		}
+	}
+}
+
+func TestScalarValues(t *testing.T) {
+	mustValue := func(s string) parser.Value {
+		t.Helper()
+		v, err := parser.ParseValue(s)
+		if err != nil {
+			t.Fatalf("ParseValue(%q): %v", s, err)
+		}
+		return v
+	}
+	t.Run("Int", func(t *testing.T) {
+		for input, want := range map[string]int64{
+			"0": 0, "+17": 17, "-5": -5, "1_000_000": 1000000,
+			"0xdead_BEEF": 0xdeadbeef, "0o755": 0o755, "0b1101": 13,
+		} {
+			if got, err := mustValue(input).Int(); err != nil || got != want {
+				t.Errorf("Int(%q): got %v, %v; want %v", input, got, err, want)
+			}
+		}
+		for _, bad := range []string{"1.5", `"5"`, "true", "[1]", "9223372036854775808"} {
+			if got, err := mustValue(bad).Int(); err == nil {
+				t.Errorf("Int(%q): got %v, want error", bad, got)
+			}
+		}
+	})
+	t.Run("Float", func(t *testing.T) {
+		for input, want := range map[string]float64{
+			"1.5": 1.5, "-0.25": -0.25, "6e-3": 6e-3, "1_000.5": 1000.5,
+			"inf": math.Inf(1), "-inf": math.Inf(-1),
+		} {
+			if got, err := mustValue(input).Float(); err != nil || got != want {
+				t.Errorf("Float(%q): got %v, %v; want %v", input, got, err, want)
+			}
+		}
+		if got, err := mustValue("-nan").Float(); err != nil || !math.IsNaN(got) {
+			t.Errorf("Float(-nan): got %v, %v; want NaN", got, err)
+		}
+		for _, bad := range []string{"1", `"1.5"`, "{a = 1.5}"} {
+			if got, err := mustValue(bad).Float(); err == nil {
+				t.Errorf("Float(%q): got %v, want error", bad, got)
+			}
+		}
+	})
+	t.Run("Bool", func(t *testing.T) {
+		if got, err := mustValue("true").Bool(); err != nil || !got {
+			t.Errorf("Bool(true): got %v, %v", got, err)
+		}
+		if got, err := mustValue("false").Bool(); err != nil || got {
+			t.Errorf("Bool(false): got %v, %v", got, err)
+		}
+		for _, bad := range []string{"1", `"true"`, "[true]"} {
+			if got, err := mustValue(bad).Bool(); err == nil {
+				t.Errorf("Bool(%q): got %v, want error", bad, got)
+			}
+		}
+	})
+	t.Run("Unquoted", func(t *testing.T) {
+		for input, want := range map[string]string{
+			`"a\tb\u00e9"`:                     "a\tb\u00e9",
+			`'C:\path'`:                        `C:\path`,
+			"\"\"\"\nline\\n \\\n  more\"\"\"": "line\n more",
+			"'''\nraw\\n'''":                   `raw\n`,
+		} {
+			if got, err := mustValue(input).Unquoted(); err != nil || got != want {
+				t.Errorf("Unquoted(%q): got %q, %v; want %q", input, got, err, want)
+			}
+		}
+		for _, bad := range []string{"5", "[\"a\"]"} {
+			if got, err := mustValue(bad).Unquoted(); err == nil {
+				t.Errorf("Unquoted(%q): got %q, want error", bad, got)
+			}
+		}
+	})
+}
+
+func TestTokenTime(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Time
+	}{
+		{"1979-05-27T07:32:00Z", time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC)},
+		{"1979-05-27 07:32:00.5-07:00", time.Date(1979, 5, 27, 7, 32, 0, 5e8, time.FixedZone("", -7*3600))},
+		{"1979-05-27t07:32:00z", time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC)},
+		{"1979-05-27T07:32:00.999", time.Date(1979, 5, 27, 7, 32, 0, 999e6, time.UTC)},
+		{"1979-05-27", time.Date(1979, 5, 27, 0, 0, 0, 0, time.UTC)},
+		{"07:32:00.25", time.Date(0, 1, 1, 7, 32, 0, 25e7, time.UTC)},
+	}
+	for _, test := range tests {
+		v := parser.MustValue(test.input)
+		got, err := v.X.(parser.Token).Time()
+		if err != nil {
+			t.Errorf("Time(%q): unexpected error: %v", test.input, err)
+		} else if !got.Equal(test.want) {
+			t.Errorf("Time(%q): got %v, want %v", test.input, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{"2021-13-01", "25:00:00", `"1979-05-27"`, "15"} {
+		v := parser.MustValue(bad)
+		if got, err := v.X.(parser.Token).Time(); err == nil {
+			t.Errorf("Time(%q): got %v, want error", bad, got)
+		}
+	}
+}
+
+func TestTimeLayout(t *testing.T) {
+	ts := time.Date(1979, 5, 27, 7, 32, 0, 5e8, time.UTC)
+	for _, tok := range []scanner.Token{
+		scanner.DateTime, scanner.LocalDateTime, scanner.LocalDate, scanner.LocalTime,
+	} {
+		layout, ok := parser.TimeLayout(tok)
+		if !ok {
+			t.Errorf("TimeLayout(%v): not found", tok)
+			continue
+		}
+		v, err := parser.ParseValue(ts.Format(layout))
+		if err != nil {
+			t.Errorf("ParseValue(%q): %v", ts.Format(layout), err)
+		} else if got := v.X.(parser.Token).Type; got != tok {
+			t.Errorf("Layout %q: got %v, want %v", layout, got, tok)
+		}
+	}
+	if layout, ok := parser.TimeLayout(scanner.Integer); ok {
+		t.Errorf("TimeLayout(%v): got %q, want none", scanner.Integer, layout)
+	}
+}
+
+func TestArrayComments(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"[1, 2, # note\n 3]", "[\n  1,\n  2,  # note\n  3,\n]"},
+		{"[ # first\n# second\n1, 2]", "[\n  # first\n  # second\n  1,\n  2,\n]"},
+		{"[1, 2,\n# after\n# more\n]", "[\n  1,\n  2,\n  # after\n  # more\n]"},
+		{"[\n# only\n]", "[\n  # only\n]"},
+		{"[1, 2, ] # tail", "[1, 2]"},
+		{"[1, # one\n  2, # two\n# note\n]", "[\n  1,  # one\n  2,  # two\n  # note\n]"},
+		{"[1, 2]", "[1, 2]"},
+		{"[[1, # one\n], [2]]", "[\n  [\n    1,  # one\n  ],\n  [2],\n]"},
+		{"[[], [[[[], 5 # ok\n]], []]]",
+			"[\n  [],\n  [\n    [\n      [\n        [],\n        5,  # ok\n      ],\n    ],\n    [],\n  ],\n]"},
+	}
+	for _, test := range tests {
+		v, err := parser.ParseValue(test.input)
+		if err != nil {
+			t.Fatalf("ParseValue(%q): %v", test.input, err)
+		}
+		got := v.String()
+		if got != test.want {
+			t.Errorf("String(%q): got %q, want %q", test.input, got, test.want)
+		}
+
+		// Rendering the parsed output again should not change it.
+		if w, err := parser.ParseValue(got); err != nil {
+			t.Errorf("ParseValue(%q): %v", got, err)
+		} else if again := w.String(); again != got {
+			t.Errorf("String(%q): got %q, want %q", got, again, got)
+		}
+	}
+}
+
+func TestInlineNestedArray(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"x = {a = [1, # c\n 2]}", "{a = [\n  1,  # c\n  2,\n]}"},
+		{"x = {a = 1, b = [[1, # c\n]], c = 3}", "{a = 1, b = [\n  [\n    1,  # c\n  ],\n], c = 3}"},
+		{"x = {a = {b = [# c\n]}}", "{a = {b = [\n  # c\n]}}"},
+		{"x = [{a = [1, # c\n]}]", "[\n  {a = [\n    1,  # c\n  ]},\n]"},
+	}
+	for _, test := range tests {
+		items, err := parser.New(strings.NewReader(test.input)).Items()
+		if err != nil {
+			t.Fatalf("Items %q: unexpected error: %v", test.input, err)
+		}
+		got := items[0].(*parser.KeyValue).Value.X.String()
+		if got != test.want {
+			t.Errorf("String(%q): got %q, want %q", test.input, got, test.want)
+		}
+
+		// The rendered value must be accepted by the default parser.
+		if _, err := parser.New(strings.NewReader("x = " + got)).Items(); err != nil {
+			t.Errorf("Items %q: unexpected error: %v", got, err)
+		}
+	}
+}
+
+func TestMultilineInline(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string // empty if an error is expected
+		multi bool
+	}{
+		{"x = {a = 1, b = 2}", "{a = 1, b = 2}", false},
+		{"x = {a = 1, b = 2}", "{a = 1, b = 2}", true},
+		{"x = {a = 1,\n b = 2}", "", false},
+		{"x = {a = 1, # one\n b = 2}", "", false},
+		{"x = {\n  a = 1,\n  b = 2\n}", "{a = 1, b = 2}", true},
+		{"x = {\n  # about a\n  a = 1, # one\n  b = 2 # two\n}", "{a = 1, b = 2}", true},
+		{"x = {a = 1,\n  # dangling\n}", "", false},
+		{"x = {\n  a = 1,\n  # tail\n}", "", false},
+		{"x = {\n  a = 1\n  # tail\n}", "{a = 1}", true},
+		{"x = {\n  a = 1, # one\n  b = 2\n  # tail 1\n  # tail 2\n}", "{a = 1, b = 2}", true},
+		{"x = {\n  # empty\n}", "", true},
+		{"x = {a = 1,\n}", "{a = 1}", true},
+		{"x = {\n  a = 1,\n  # tail\n}", "{a = 1}", true},
+		{"x = {\n,}", "", true},
+		{"x = {a = 1", "", true},
+	}
+	for _, test := range tests {
+		p := parser.New(strings.NewReader(test.input))
+		p.MultilineInline = test.multi
+		items, err := p.Items()
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("Items %q (multi=%v): got %v, wanted error", test.input, test.multi, items)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Items %q (multi=%v): unexpected error: %v", test.input, test.multi, err)
+			continue
+		}
+		if got := items[0].(*parser.KeyValue).Value.X.String(); got != test.want {
+			t.Errorf("Items %q (multi=%v): got %q, want %q", test.input, test.multi, got, test.want)
+		}
+	}
+}
+
+func TestArrayValues(t *testing.T) {
+	arr := parser.MustValue("[# head\n 1, 2, # mid\n 3]").X.(parser.Array)
+	values := func() string {
+		var vs []string
+		for _, v := range arr.Values() {
+			vs = append(vs, v.String())
+		}
+		return strings.Join(vs, " ")
+	}
+	if got, want := values(), "1 2 3"; got != want {
+		t.Errorf("Values: got %q, want %q", got, want)
+	}
+
+	arr.Append(parser.MustValue("4"))
+	arr.RemoveIndex(0)
+	arr.RemoveIndex(1)
+	if got, want := values(), "2 4"; got != want {
+		t.Errorf("Values: got %q, want %q", got, want)
+	}
+	if got, want := arr.String(), "[\n  # head\n  2,  # mid\n  4,\n]"; got != want {
+		t.Errorf("String: got %q, want %q", got, want)
+	}
+
+	defer func() {
+		if x := recover(); x == nil {
+			t.Error("RemoveIndex(2): did not panic")
+		}
+	}()
+	arr.RemoveIndex(2)
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		input      string
+		line, col  int
+		text, want string
+	}{
+		{"a = 1\nb = [1,\n  2 3]\n", 3, 4, "3", `got integer, want ","`},
+		{"[x]\n  y == 2\n", 2, 5, "=", "wanted value"},
+		{"a = 1\n[[t] x]\n", 2, 5, "x", `want "]]"`},
+		{"s = 'abc\n", 1, 4, "'abc\n", "offset 9"},
+	}
+	for _, test := range tests {
+		_, err := parser.New(strings.NewReader(test.input)).Items()
+		var perr *parser.ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("Items(%q): got error %v, want *ParseError", test.input, err)
+			continue
+		}
+		if perr.Line != test.line || perr.Column != test.col || perr.Text != test.text {
+			t.Errorf("Items(%q): got %d:%d %q, want %d:%d %q", test.input,
+				perr.Line, perr.Column, perr.Text, test.line, test.col, test.text)
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Items(%q): got error %q, want %q", test.input, err, test.want)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	const input = "# é\n  a = {b = 1}\n\n[t]\n  \"ü\".c = 2 # x\n  [[u]]\n"
+	items, err := parser.New(strings.NewReader(input)).Items()
+	if err != nil {
+		t.Fatalf("Items: unexpected error: %v", err)
+	}
+	var got []string
+	check := func(label string, pos parser.Position) {
+		t.Helper()
+		if !strings.HasPrefix(input[pos.Offset:], label) {
+			t.Errorf("Position %v of %q: offset %d points to %q", pos, label, pos.Offset, input[pos.Offset:])
+		}
+		got = append(got, fmt.Sprintf("%s@%v", label, pos))
+	}
+	for _, item := range items {
+		switch t := item.(type) {
+		case *parser.Heading:
+			check(t.String(), t.Pos)
+		case *parser.KeyValue:
+			check(t.Name.String(), t.Pos)
+			if in, ok := t.Value.X.(parser.Inline); ok {
+				check(in[0].Name.String(), in[0].Pos)
+			}
+		}
+	}
+	want := []string{"a@2:2", "b@2:7", "[t]@4:0", `"ü".c@5:2`, "[[u]]@6:2"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Positions: (-want, +got)\n%s", diff)
+	}
+	if (parser.Position{}).IsValid() {
+		t.Error("Zero position is valid")
+	}
+}
+
+func TestEach(t *testing.T) {
+	const input = "a = 1\n# free\n\n[t]\nb = 2\n[u]\nc = 3\n"
+	var got []string
+	collect := func(item parser.Item) error {
+		got = append(got, fmt.Sprint(item))
+		if kv, ok := item.(*parser.KeyValue); ok && kv.Name[0] == "b" {
+			return parser.ErrStopScan
+		}
+		return nil
+	}
+	if err := parser.New(strings.NewReader(input)).Each(collect); err != nil {
+		t.Fatalf("Each: unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"a = 1", "# free", "[t]", "b = 2"}, got); diff != "" {
+		t.Errorf("Each: (-want, +got)\n%s", diff)
+	}
+
+	// Errors from the callback are returned unchanged.
+	errTest := errors.New("test error")
+	err := parser.New(strings.NewReader(input)).Each(func(parser.Item) error { return errTest })
+	if err != errTest {
+		t.Errorf("Each: got error %v, want %v", err, errTest)
+	}
+
+	// Syntax errors are reported after the items preceding them.
+	got = nil
+	err = parser.New(strings.NewReader("a = 1\nb = = 2\n")).Each(collect)
+	var perr *parser.ParseError
+	if !errors.As(err, &perr) {
+		t.Errorf("Each: got error %v, want *ParseError", err)
+	}
+	if diff := cmp.Diff([]string{"a = 1"}, got); diff != "" {
+		t.Errorf("Each: (-want, +got)\n%s", diff)
+	}
+}
+
+func TestValueEqual(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{`1000`, `1_000`, true},
+		{`255`, `0xff`, true},
+		{`1`, `1.0`, false},
+		{`1.5`, `15e-1`, true},
+		{`nan`, `-nan`, true},
+		{`inf`, `+inf`, true},
+		{`inf`, `-inf`, false},
+		{`true`, `true`, true},
+		{`true`, `false`, false},
+		{`"a"`, `'a'`, true},
+		{`"a\tb"`, `"""a	b"""`, true},
+		{`"a"`, `"b"`, false},
+		{`"1"`, `1`, false},
+		{`1979-05-27T07:32:00Z`, `1979-05-27 00:32:00-07:00`, true},
+		{`1979-05-27T07:32:00`, `1979-05-27 07:32:00`, true},
+		{`1979-05-27T07:32:00`, `1979-05-27T07:32:00Z`, false},
+		{`1979-05-27`, `1979-05-27`, true},
+		{`07:32:00`, `07:32:00.000`, true},
+		{`[1, 2]`, "[\n  1,  # one\n  2,\n]", true},
+		{`[1, 2]`, `[2, 1]`, false},
+		{`[1, 2]`, `[1, 2, 3]`, false},
+		{`[]`, `{}`, false},
+		{`{a = 1, b = 2}`, `{b = 2, a = 1}`, true},
+		{`{a.b = 1, c = 2}`, `{c = 2, a = {b = 1}}`, true},
+		{`{a = 1}`, `{a = 1, b = 2}`, false},
+		{`{a = {}}`, `{}`, false},
+		{`{a = {}}`, `{a = {}}`, true},
+	}
+	for _, tc := range tests {
+		a := parser.MustValue(tc.a)
+		b := parser.MustValue(tc.b)
+		if got := a.Equal(b); got != tc.want {
+			t.Errorf("Equal(%s, %s): got %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+		if got := b.Equal(a); got != tc.want {
+			t.Errorf("Equal(%s, %s): got %v, want %v", tc.b, tc.a, got, tc.want)
+		}
+	}
+	if !(parser.Value{}).Equal(parser.Value{}) {
+		t.Error("Equal of empty values: got false, want true")
+	}
+}
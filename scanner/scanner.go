@@ -102,15 +102,26 @@ type Scanner struct {
 	eline, ecol int
 }
 
-// New constructs a new lexical scanner that consumes input from r.
+// New constructs a new lexical scanner that consumes input from r.  If the
+// input begins with a UTF-8 byte-order mark (U+FEFF), it is skipped. Offsets
+// reported by the scanner include the length of the mark, but it does not
+// affect column positions.
 func New(r io.Reader) *Scanner {
 	br, ok := r.(*bufio.Reader)
 	if !ok {
 		br = bufio.NewReader(r)
 	}
-	return &Scanner{r: br}
+	s := &Scanner{r: br}
+	if b, _ := br.Peek(len(byteOrderMark)); string(b) == byteOrderMark {
+		br.Discard(len(byteOrderMark))
+		s.pos, s.end = len(byteOrderMark), len(byteOrderMark)
+	}
+	return s
 }
 
+// byteOrderMark is the UTF-8 encoding of a byte-order mark (U+FEFF).
+const byteOrderMark = "\uFEFF"
+
 // Next advances s to the next token of the input, or reports an error.
 // At the end of the input, Next returns io.EOF.
 func (s *Scanner) Next() error {
@@ -130,13 +141,15 @@ func (s *Scanner) Next() error {
 		// Skip whitespace, but keep track of line breaks. Line breaks are
 		// significant to the syntax, so they are returned as a token.
 		if isSpace(ch) {
-			s.pos, s.pline, s.pcol = s.end, s.eline, s.ecol
 			if ch == '\n' {
+				// The span of a line break includes the break itself.
+				s.pos, s.pline, s.pcol = s.end-s.last, s.eline, s.ecol-s.last
 				s.eline++
 				s.ecol = 0
 				s.tok = Newline
 				return nil
 			}
+			s.pos, s.pline, s.pcol = s.end, s.eline, s.ecol
 			s.prev = Invalid // whitespace interrupts tokens
 			continue
 		}
@@ -183,7 +196,10 @@ func (s *Scanner) Err() error { return s.err }
 // the returned slice if it is needed beyond that.
 func (s *Scanner) Text() []byte { return s.buf.Bytes() }
 
-// Span returns the location span of the current token.
+// Span returns the location span of the current token. The span gives the
+// byte offsets of the token in the input, so that input[Pos:End] is the
+// complete source text of the token. The span of a line break covers the
+// newline, and the span of a comment includes the line break that ends it.
 func (s *Scanner) Span() Span { return Span{Pos: s.pos, End: s.end} }
 
 // Location returns the complete location of the current token.
@@ -28,6 +28,9 @@ func TestScanner(t *testing.T) {
 		{"# complete comment\n", []result{{scanner.Comment, "# complete comment"}}},
 		{"# EOF comment", []result{{scanner.Comment, "# EOF comment"}}},
 
+		{"\uFEFF", nil},
+		{"\uFEFFa = 1", []result{{scanner.Word, "a"}, {scanner.Equal, "="}, {scanner.Integer, "1"}}},
+
 		{`0`, []result{{scanner.Integer, "0"}}},
 		{`100`, []result{{scanner.Integer, "100"}}},
 		{`-256_512`, []result{{scanner.Integer, "-256_512"}}},
@@ -122,6 +125,41 @@ frob = 2021-12-01
 	}
 }
 
+func TestByteOrderMark(t *testing.T) {
+	s := scanner.New(strings.NewReader("\uFEFFkey = 1"))
+	if err := s.Next(); err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	want := scanner.Location{
+		Span:  scanner.Span{Pos: 3, End: 6},
+		First: scanner.LineCol{Line: 1, Column: 0},
+		Last:  scanner.LineCol{Line: 1, Column: 3},
+	}
+	if diff := cmp.Diff(want, s.Location()); diff != "" {
+		t.Errorf("Location (-want, +got):\n%s", diff)
+	}
+}
+
+func TestSpan(t *testing.T) {
+	const input = "\uFEFF# head\nkey = \"\"\"a\nb\"\"\" # tail\n[x . 'y']  \n\"😍\" = 1979-05-27"
+	want := []string{
+		"# head\n", "key", "=", `"""a` + "\n" + `b"""`, "# tail\n",
+		"[", "x", ".", "'y'", "]", "\n", `"😍"`, "=", "1979-05-27",
+	}
+	var got []string
+	s := scanner.New(strings.NewReader(input))
+	for s.Next() == nil {
+		sp := s.Span()
+		got = append(got, input[sp.Pos:sp.End])
+	}
+	if s.Err() != io.EOF {
+		t.Errorf("Next failed: %v", s.Err())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Spans (-want, +got):\n%s", diff)
+	}
+}
+
 func TestEscape(t *testing.T) {
 	tests := []struct {
 		input, want string
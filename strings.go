@@ -0,0 +1,108 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package tomledit
+
+import (
+	"strings"
+
+	"github.com/creachadair/tomledit/parser"
+	"github.com/creachadair/tomledit/scanner"
+)
+
+// A StringRef is a reference to a string value in a document.
+type StringRef struct {
+	// The full key of the mapping whose value contains the string. For a
+	// string inside an inline table, this includes the keys of the table.
+	Key parser.Key
+
+	// For a string inside an array, the offsets of the string and of each
+	// enclosing array among the values of their arrays, outermost first.
+	// Comments inside an array are not counted. Otherwise this is empty.
+	Index []int
+
+	// The content of the string, with quotes removed and escapes decoded.
+	Value string
+
+	// Set replaces the string in the document with a basic string having the
+	// content s. The replacement is a multi-line string if the original was.
+	// Calling Set does not update the Value field.
+	Set func(s string)
+}
+
+// Strings returns references to all the string values in d, in order of
+// occurrence, including strings inside arrays and inline tables.  Strings
+// whose escapes are invalid are omitted.
+func (d *Document) Strings() []StringRef {
+	var out []StringRef
+	visit := func(s *Section) {
+		if s == nil {
+			return
+		}
+		for _, item := range s.Items {
+			if kv, ok := item.(*parser.KeyValue); ok {
+				key := append(append(parser.Key(nil), s.TableName()...), kv.Name...)
+				out = stringsOf(out, key, nil, kv.Value.X, func(d parser.Datum) { kv.Value.X = d })
+			}
+		}
+	}
+	visit(d.Global)
+	for _, s := range d.Sections {
+		visit(s)
+	}
+	return out
+}
+
+// stringsOf appends references to the strings in d to out, where key and idx
+// give the location of d, and set replaces d in its container.
+func stringsOf(out []StringRef, key parser.Key, idx []int, d parser.Datum, set func(parser.Datum)) []StringRef {
+	switch t := d.(type) {
+	case parser.Token:
+		content, err := t.Unquote()
+		if err != nil {
+			return out
+		}
+		multi := t.Type == scanner.MString || t.Type == scanner.MLString
+		return append(out, StringRef{
+			Key:   key,
+			Index: idx,
+			Value: content,
+			Set:   func(s string) { set(quote(s, multi)) },
+		})
+
+	case parser.Array:
+		var n int
+		for i, elt := range t {
+			v, ok := elt.(parser.Value)
+			if !ok {
+				continue
+			}
+			sub := append(append([]int(nil), idx...), n)
+			out = stringsOf(out, key, sub, v.X, func(d parser.Datum) {
+				v := t[i].(parser.Value)
+				v.X = d
+				t[i] = v
+			})
+			n++
+		}
+
+	case parser.Inline:
+		for _, kv := range t {
+			sub := append(append(parser.Key(nil), key...), kv.Name...)
+			out = stringsOf(out, sub, idx, kv.Value.X, func(d parser.Datum) { kv.Value.X = d })
+		}
+	}
+	return out
+}
+
+// quote returns a basic string token with content s.
+func quote(s string, multi bool) parser.Datum {
+	if !multi {
+		return parser.MustValue(`"` + string(scanner.Escape(s)) + `"`).X
+	}
+	// A newline just after the opening delimiter would be discarded, so add an
+	// extra one to preserve a leading newline in s.
+	if strings.HasPrefix(s, "\n") {
+		s = "\n" + s
+	}
+	return parser.MustValue(`"""` + string(scanner.EscapeMultiline(s)) + `"""`).X
+}
@@ -89,6 +89,7 @@ package tomledit
 import (
 	"fmt"
 	"io"
+	"slices"
 
 	"github.com/creachadair/tomledit/parser"
 )
@@ -135,6 +136,142 @@ func (d *Document) Find(key ...string) []*Entry {
 	return found
 }
 
+// FindSections returns all the table sections of d whose name equals name, in
+// order of occurrence, or nil. For an array table, this includes every element
+// of the array.
+func (d *Document) FindSections(name parser.Key) []*Section {
+	var found []*Section
+	for _, s := range d.Sections {
+		if s.TableName().Equals(name) {
+			found = append(found, s)
+		}
+	}
+	return found
+}
+
+// Set replaces the value of the mapping for key with v. It reports an error
+// if key is not found, if it has more than one definition, or if it denotes a
+// table rather than a mapping.
+func (d *Document) Set(key parser.Key, v parser.Value) error {
+	found := d.Find(key...)
+	if len(found) == 0 {
+		return fmt.Errorf("key %q not found", key)
+	} else if len(found) > 1 {
+		return fmt.Errorf("found %d definitions of key %q", len(found), key)
+	} else if !found[0].IsMapping() {
+		return fmt.Errorf("%q is not a key-value mapping", key)
+	}
+	found[0].KeyValue.Value = v
+	return nil
+}
+
+// Add adds a mapping for key with value v to the table named by section, and
+// reports an error if the mapping already exists and replace is false. An
+// empty section denotes the global table. If the table does not exist, a new
+// section for it is added to the end of d. If the table is an array of tables,
+// the mapping is added to its first element.
+//
+// A new mapping is added to the end of the table, before any free-standing
+// comments that end the section. If replace is true, an existing mapping for
+// key is replaced in place.
+func (d *Document) Add(section, key parser.Key, v parser.Value, replace bool) error {
+	var s *Section
+	if len(section) == 0 {
+		if d.Global == nil {
+			d.Global = new(Section)
+		}
+		s = d.Global
+	} else if e := d.First(section...); e == nil {
+		s = &Section{Heading: &parser.Heading{Name: section}}
+		d.Sections = append(d.Sections, s)
+	} else if e.IsSection() {
+		s = e.Section
+	} else {
+		return fmt.Errorf("%q is not a table", section)
+	}
+	if !insertMapping(s, &parser.KeyValue{Name: key, Value: v}, replace) {
+		return fmt.Errorf("key %q exists in table %q", key, section)
+	}
+	return nil
+}
+
+// insertMapping inserts kv into s as described by Document.Add, and reports
+// whether kv was inserted or replaced an existing mapping.
+func insertMapping(s *Section, kv *parser.KeyValue, replace bool) bool {
+	for _, item := range s.Items {
+		if cur, ok := item.(*parser.KeyValue); ok && cur.Name.Equals(kv.Name) {
+			if !replace {
+				return false
+			}
+			cur.Value = kv.Value
+			return true
+		}
+	}
+	i := len(s.Items)
+	for i > 0 && isComments(s.Items[i-1]) {
+		i--
+	}
+	s.Items = slices.Insert(s.Items, i, parser.Item(kv))
+	return true
+}
+
+func isComments(item parser.Item) bool { _, ok := item.(parser.Comments); return ok }
+
+// Delete removes the first entry in d with the given key, and reports whether
+// an entry was removed. Deleting a table removes its section, including all
+// the mappings it contains.
+func (d *Document) Delete(key parser.Key) bool { return d.First(key...).Remove() }
+
+// DeleteAll removes all the entries in d with the given key, such as all the
+// elements of an array of tables, and returns the number of entries removed.
+func (d *Document) DeleteAll(key parser.Key) int {
+	var n int
+	for _, e := range d.Find(key...) {
+		if e.Remove() {
+			n++
+		}
+	}
+	return n
+}
+
+// ArrayTableNames returns the distinct names of the array tables ([[name]])
+// defined in d, in order of first occurrence.
+func (d *Document) ArrayTableNames() []parser.Key {
+	var names []parser.Key
+nextSection:
+	for _, s := range d.Sections {
+		if s.Heading == nil || !s.IsArray {
+			continue
+		}
+		for _, name := range names {
+			if name.Equals(s.Name) {
+				continue nextSection
+			}
+		}
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// ClearGlobalValues removes all the key-value mappings from the global section
+// of d, along with their attached comments, but retains the free-standing
+// comment blocks, such as a license header. It reports the number of mappings
+// removed.
+func (d *Document) ClearGlobalValues() int {
+	if d.Global == nil {
+		return 0
+	}
+	var keep []parser.Item
+	for _, item := range d.Global.Items {
+		if _, ok := item.(*parser.KeyValue); !ok {
+			keep = append(keep, item)
+		}
+	}
+	n := len(d.Global.Items) - len(keep)
+	d.Global.Items = keep
+	return n
+}
+
 // Scan calls f for every key-value pair defined in d, in lexical order.
 // The arguments to f are the complete key of the item and the entry.
 // Traversal continues until all items have been visited or f returns false.
@@ -155,6 +292,19 @@ func (d *Document) Scan(f func(parser.Key, *Entry) bool) bool {
 	return true
 }
 
+// ScanErr calls f for every key-value pair defined in d, in the same order as
+// Scan. Traversal continues until all items have been visited or f reports an
+// error, in which case ScanErr returns that error. The same restrictions on
+// editing apply as for Scan.
+func (d *Document) ScanErr(f func(parser.Key, *Entry) error) error {
+	var err error
+	d.Scan(func(key parser.Key, e *Entry) bool {
+		err = f(key, e)
+		return err == nil
+	})
+	return err
+}
+
 // A Section represents a section of a TOML document.  A section represents a
 // table and all the block comments and key-value pairs it contains.
 type Section struct {
@@ -225,6 +375,28 @@ func (s *Section) Scan(f func(parser.Key, *Entry) bool) bool {
 	return true
 }
 
+// Find returns the first entry defined inside s with the given key, or nil.
+// The key is relative to s, and does not include the name of the table; for
+// example, if s is the table [a.b], the key c finds the mapping for a.b.c.
+// Keys inside inline tables are included in the search.
+//
+// Unlike the First method of a Document, Find does not visit the contents of
+// any other section of the document.
+func (s *Section) Find(key ...string) *Entry {
+	// N.B. Copy the table name, so that appending does not clobber it.
+	want := append(append(parser.Key(nil), s.TableName()...), key...)
+
+	var found *Entry
+	s.Scan(func(full parser.Key, e *Entry) bool {
+		if full.Equals(want) {
+			found = e
+			return false
+		}
+		return true
+	})
+	return found
+}
+
 // scanInline recursively scans the contents of an inline table.
 func scanInline(root parser.Key, s *Section, par *parser.Datum, f func(parser.Key, *Entry) bool) bool {
 	inline, ok := (*par).(parser.Inline)
@@ -233,7 +405,7 @@ func scanInline(root parser.Key, s *Section, par *parser.Datum, f func(parser.Ke
 	}
 	for _, kv := range inline {
 		key := append(root, kv.Name...)
-		if !f(key, &Entry{Section: s, KeyValue: kv, parent: par}) {
+		if !f(key, &Entry{Section: s, KeyValue: kv, parent: par, path: slices.Clone(key)}) {
 			return false
 		}
 		if !scanInline(key, s, &kv.Value.X, f) {
@@ -260,6 +432,24 @@ type Entry struct {
 	// For top-level mappings: *[]parser.Item
 	// For inline mappings: *parser.Datum containing parser.Inline
 	parent interface{}
+
+	// For inline mappings, the complete key of the entry.
+	path parser.Key
+}
+
+// Path returns the complete key of e: The name of the table for an entry
+// representing a section, or the full key of the mapping otherwise, including
+// the keys of any enclosing inline tables. The result does not share storage
+// with the document.
+func (e *Entry) Path() parser.Key {
+	if e.path != nil {
+		return slices.Clone(e.path)
+	}
+	path := slices.Clone(e.Section.TableName())
+	if e.IsMapping() {
+		path = append(path, e.Name...)
+	}
+	return path
 }
 
 func (e Entry) String() string {
@@ -319,20 +509,78 @@ func (e Entry) IsMapping() bool { return e.KeyValue != nil }
 // IsInline reports whether e is inside an inline table.
 func (e Entry) IsInline() bool {
 	if e.KeyValue != nil {
-		_, ok := e.parent.(*parser.Inline)
+		_, ok := e.parent.(*parser.Datum)
 		return ok
 	}
 	return false
 }
 
-// Parse parses a TOML document from r.
+// Parse parses a TOML document from r with default options.
 func Parse(r io.Reader) (*Document, error) {
-	items, err := parser.New(r).Items()
+	var opts ParseOptions
+	return opts.Parse(r)
+}
+
+// ParseOptions defines options for parsing a TOML document.  The zero value is
+// ready for use with default options, which follow the TOML specification.
+type ParseOptions struct {
+	// If true, accept common non-standard spellings of Boolean values, such as
+	// "True", "FALSE", "on", and "off". These are normalized to "true" and
+	// "false" in the parsed document. See parser.Parser.
+	LenientBooleans bool
+
+	// If true, accept a trailing comma after the last entry of an inline table,
+	// as permitted by the TOML v1.1 draft. See parser.Parser.
+	InlineTrailingComma bool
+
+	// If true, accept line breaks and comments between the entries of an
+	// inline table, as permitted by the TOML v1.1 draft. The comments are
+	// retained on the entries of the table, and are written back only by a
+	// Formatter with MultilineInline set. This also accepts a trailing comma
+	// after the last entry. See parser.Parser.
+	MultilineInline bool
+
+	// If true, report an error for a key or table that is defined more than
+	// once in the same table, or that is defined both as a table and as a
+	// value, as the TOML specification requires. By default, such definitions
+	// are accepted and retained in the document, which is useful for editing
+	// documents that do not strictly conform.
+	StrictDuplicates bool
+}
+
+// Parse parses a TOML document from r using the options in o.  A syntax error
+// has concrete type *parser.ParseError, reporting its location in the input.
+func (o ParseOptions) Parse(r io.Reader) (*Document, error) {
+	doc, err := o.ParsePartial(r)
 	if err != nil {
 		return nil, err
 	}
+	return doc, nil
+}
+
+// ParsePartial parses a TOML document from r with default options.
+// See ParseOptions.ParsePartial.
+func ParsePartial(r io.Reader) (*Document, error) {
+	var opts ParseOptions
+	return opts.ParsePartial(r)
+}
+
+// ParsePartial parses a TOML document from r using the options in o.
+// Unlike Parse, if an error occurs ParsePartial returns a document containing
+// all the items successfully parsed prior to the error, along with the error.
+// The returned document is never nil.
+func (o ParseOptions) ParsePartial(r io.Reader) (*Document, error) {
+	p := parser.New(r)
+	p.LenientBooleans = o.LenientBooleans
+	p.InlineTrailingComma = o.InlineTrailingComma
+	p.MultilineInline = o.MultilineInline
+	items, err := p.Items()
 	sec := parseSections(items)
-	return &Document{Global: sec[0], Sections: sec[1:]}, nil
+	doc := &Document{Global: sec[0], Sections: sec[1:]}
+	if err == nil && o.StrictDuplicates {
+		err = checkDuplicates(doc)
+	}
+	return doc, err
 }
 
 // parseSections parses items into a slice of sections. The result will always
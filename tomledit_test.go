@@ -4,15 +4,21 @@ package tomledit_test
 
 import (
 	"bytes"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/creachadair/tomledit"
 	"github.com/creachadair/tomledit/parser"
+	"github.com/creachadair/tomledit/scanner"
 	"github.com/creachadair/tomledit/transform"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 var (
@@ -228,6 +234,14 @@ func TestEdit(t *testing.T) {
 				doc.Global = nil
 			},
 		},
+		{
+			desc:  "clear global values",
+			input: "# License\n\nx=5\n# about y\ny=10\n\n# Note\n[z]\nok=true",
+			want:  "# License\n\n# Note\n[z]\nok = true",
+			edit: func(doc *tomledit.Document) {
+				doc.ClearGlobalValues()
+			},
+		},
 		{
 			desc:  "remove inline",
 			input: "[top]\nx={a=1,c=2}\n",
@@ -289,6 +303,28 @@ func TestEdit(t *testing.T) {
 				kv.Value.X = tab
 			},
 		},
+		{
+			desc:  "update inline mapping",
+			input: "x={a=0, b=1}",
+			want:  "x = {a = 0, b = 'pears', c = 2}",
+			edit: func(doc *tomledit.Document) {
+				kv := doc.First("x").KeyValue
+				tab := kv.Value.X.(parser.Inline)
+				if tab.Find("c") != nil {
+					t.Error("Find(c): got a mapping, want nil")
+				}
+				if !tab.Set("b", parser.MustValue(`'pears'`)) {
+					t.Error("Set(b): reported a new mapping")
+				}
+				if tab.Set("c", parser.MustValue(`2`)) {
+					t.Error("Set(c): reported an existing mapping")
+				}
+				if got := tab.Find("a"); got == nil || got.Value.String() != "0" {
+					t.Errorf("Find(a): got %v, want a = 0", got)
+				}
+				kv.Value.X = tab
+			},
+		},
 		{
 			desc:  "sort key-value items",
 			input: "# stay1\n\n# xc\nx=5\n# stay2\n\na=1\nm=3\n# rc\nr=4\na=2",
@@ -314,3 +350,1811 @@ func TestEdit(t *testing.T) {
 		})
 	}
 }
+
+func TestFeatures(t *testing.T) {
+	tests := []struct {
+		input string
+		want  tomledit.FeatureSet
+	}{
+		{"", 0},
+		{"a = 1\nb = 'two'\n[c]\nd = 3.5", 0},
+		{"[[a]]\nb = 1", tomledit.ArrayTables},
+		{"a = {}", tomledit.EmptyInlineTables},
+		{"a = {b = {}}", tomledit.InlineTables | tomledit.EmptyInlineTables},
+		{"a = [0x1f, 0o17, 0b11]", tomledit.HexIntegers | tomledit.OctalIntegers | tomledit.BinaryIntegers},
+		{"a = [{b = -inf}]\n[c]\nd = nan", tomledit.InlineTables | tomledit.SpecialFloats},
+		{"a = 1979-05-27T07:32:00Z\nb = 1979-05-27T07:32:00", tomledit.OffsetDateTimes | tomledit.LocalDateTimes},
+		{"[[x]]\na = 1979-05-27\nb = 07:32:00", tomledit.ArrayTables | tomledit.LocalDates | tomledit.LocalTimes},
+	}
+	for _, test := range tests {
+		got := tomledit.Features(mustParse(t, test.input))
+		if got != test.want {
+			t.Errorf("Features %q: got %v, want %v", test.input, got, test.want)
+		}
+	}
+
+	t.Run("Has", func(t *testing.T) {
+		fs := tomledit.ArrayTables | tomledit.LocalDates
+		if !fs.Has(tomledit.ArrayTables) {
+			t.Errorf("%v: missing %v", fs, tomledit.ArrayTables)
+		}
+		if fs.Has(tomledit.ArrayTables | tomledit.HexIntegers) {
+			t.Errorf("%v: unexpectedly has %v", fs, tomledit.HexIntegers)
+		}
+		if got, want := fs.String(), "array tables, local dates"; got != want {
+			t.Errorf("String: got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestSectionFind(t *testing.T) {
+	doc := mustParse(t, testDoc)
+
+	tests := []struct {
+		section *tomledit.Section
+		key     []string
+		want    string // empty if no match is expected
+	}{
+		{doc.Global, []string{"p"}, "p = {q = [], r = {}}"},
+		{doc.Global, []string{"p", "r"}, "r = {}"},
+		{doc.Global, []string{"first", "table"}, ""},
+		{doc.Sections[0], []string{"x"}, "x = 14"},
+		{doc.Sections[0], []string{"fuss", "budget", "x"}, "x = true"},
+		{doc.Sections[0], []string{"foo"}, ""},
+		{doc.Sections[1], []string{"foo"}, "foo = 'bar'"},
+		{doc.Sections[2], []string{"r", "s", "t"}, "s.t = 'u'"},
+		{doc.Sections[3], []string{"r"}, ""},
+	}
+	for _, test := range tests {
+		got := test.section.Find(test.key...)
+		if got == nil {
+			if test.want != "" {
+				t.Errorf("Find %q in %v: got nil, want %q", test.key, test.section.Heading, test.want)
+			}
+			continue
+		}
+		if s := got.KeyValue.String(); s != test.want {
+			t.Errorf("Find %q in %v: got %q, want %q", test.key, test.section.Heading, s, test.want)
+		}
+	}
+}
+
+func TestFormatSections(t *testing.T) {
+	doc := mustParse(t, `# header
+top = 1
+
+# database config
+[database]
+host = "db" # the host
+
+[cache]
+size = 10
+
+[[p]]
+q = 1
+
+[other]
+x = 0
+
+[[p]]
+q = 2
+`)
+	tests := []struct {
+		names []parser.Key
+		want  string
+	}{
+		{nil, ""},
+		{[]parser.Key{{"nonesuch"}}, ""},
+		{[]parser.Key{{"cache"}, {"database"}},
+			"# database config\n[database]\nhost = \"db\"  # the host\n\n[cache]\nsize = 10"},
+		{[]parser.Key{{}, {"p"}},
+			"# header\ntop = 1\n\n[[p]]\nq = 1\n\n[[p]]\nq = 2"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := tomledit.FormatSections(&buf, doc, test.names...); err != nil {
+			t.Fatalf("FormatSections %q: %v", test.names, err)
+		}
+		if diff := cmp.Diff(test.want, strings.TrimSpace(buf.String())); diff != "" {
+			t.Errorf("FormatSections %q: (-want, +got)\n%s", test.names, diff)
+		}
+	}
+}
+
+func TestArrayTableNames(t *testing.T) {
+	doc := mustParse(t, `[[p]]
+[a]
+[[q.r]]
+[[p]]
+[b]
+[[s]]
+[[q.r]]
+`)
+	want := []parser.Key{{"p"}, {"q", "r"}, {"s"}}
+	if diff := cmp.Diff(want, doc.ArrayTableNames()); diff != "" {
+		t.Errorf("ArrayTableNames: (-want, +got)\n%s", diff)
+	}
+	if got := mustParse(t, "[a]\nx = 1\n").ArrayTableNames(); got != nil {
+		t.Errorf("ArrayTableNames: got %q, want nil", got)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	const input = "[x]\nenabled = On\nverbose = False\n"
+	if doc, err := tomledit.Parse(strings.NewReader(input)); err == nil {
+		t.Errorf("Parse: got %v, wanted error", doc)
+	}
+
+	opts := tomledit.ParseOptions{LenientBooleans: true}
+	doc, err := opts.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tomledit.Format(&buf, doc); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	const want = "[x]\nenabled = true\nverbose = false"
+	if diff := cmp.Diff(want, strings.TrimSpace(buf.String())); diff != "" {
+		t.Errorf("Output: (-want, +got)\n%s", diff)
+	}
+}
+
+func TestParsePartial(t *testing.T) {
+	const input = `# header
+a = 1
+[t]
+b = 2
+c = [1, 2
+[u]
+d = 3
+`
+	if doc, err := tomledit.Parse(strings.NewReader(input)); err == nil {
+		t.Fatalf("Parse: got %v, wanted error", doc)
+	}
+	doc, err := tomledit.ParsePartial(strings.NewReader(input))
+	if err == nil {
+		t.Fatal("ParsePartial: got nil error, wanted error")
+	}
+	t.Logf("ParsePartial: correctly failed: %v", err)
+
+	var buf bytes.Buffer
+	if err := tomledit.Format(&buf, doc); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	const want = "# header\na = 1\n\n[t]\nb = 2"
+	if diff := cmp.Diff(want, strings.TrimSpace(buf.String())); diff != "" {
+		t.Errorf("Partial document: (-want, +got)\n%s", diff)
+	}
+
+	// A valid document parses completely without error.
+	if _, err := tomledit.ParsePartial(strings.NewReader("a = 1\n[b]\n")); err != nil {
+		t.Errorf("ParsePartial: unexpected error: %v", err)
+	}
+}
+
+func TestSectionsEqual(t *testing.T) {
+	const base = "[t] # tab\n# about a\na = 1\nb = 'x' # bee\n# free\n\nc = [1, 2]\n"
+	tests := []struct {
+		other                    string
+		exact, noCom, noOrd, any bool
+	}{
+		{base, true, true, true, true},
+		{"#tab\n[t]#tab\n#   about a\na=1\nb='x'#   bee\n#free\n\nc=[1,2]\n", false, true, false, true},
+		{"[t] # tab\n# free\n\nc = [1, 2]\nb = 'x' # bee\n# about a\na = 1\n", false, false, true, true},
+		{"[t]\nb = 'x'\nc = [1, 2]\na = 1\n", false, false, false, true},
+		{"[t] # tab\n# about a\na = 1\nb = 'y' # bee\n# free\n\nc = [1, 2]\n", false, false, false, false},
+		{"[[t]] # tab\n# about a\na = 1\nb = 'x' # bee\n# free\n\nc = [1, 2]\n", false, false, false, false},
+		{"[u] # tab\n# about a\na = 1\nb = 'x' # bee\n# free\n\nc = [1, 2]\n", false, false, false, false},
+		{"[t] # tab\n# about a\na = 1\nb = 'x' # bee\n# free\n\nc = [1, 2]\nd = 0\n", false, false, false, false},
+		{"[t] # tab\n# about a\na = 0x1\nb = \"x\" # bee\n# free\n\nc = [1, +2]\n", true, true, true, true},
+	}
+	lhs := mustParse(t, base).Sections[0]
+	for _, test := range tests {
+		rhs := mustParse(t, test.other).Sections[0]
+		check := func(opts tomledit.CompareOptions, want bool) {
+			t.Helper()
+			if got := tomledit.SectionsEqual(lhs, rhs, opts); got != want {
+				t.Errorf("SectionsEqual(%+v):\n%s\n--\n%s\ngot %v, want %v", opts, base, test.other, got, want)
+			}
+		}
+		check(tomledit.CompareOptions{}, test.exact)
+		check(tomledit.CompareOptions{IgnoreComments: true}, test.noCom)
+		check(tomledit.CompareOptions{IgnoreOrder: true}, test.noOrd)
+		check(tomledit.CompareOptions{IgnoreComments: true, IgnoreOrder: true}, test.any)
+	}
+
+	if !tomledit.SectionsEqual(nil, nil, tomledit.CompareOptions{}) {
+		t.Error("SectionsEqual(nil, nil): got false, want true")
+	}
+	if tomledit.SectionsEqual(lhs, nil, tomledit.CompareOptions{}) {
+		t.Error("SectionsEqual(s, nil): got true, want false")
+	}
+}
+
+func TestInlineTrailingComma(t *testing.T) {
+	const input = "a = {x = 1, y = {z = 2,},}\nb = {}\n"
+	if doc, err := tomledit.Parse(strings.NewReader(input)); err == nil {
+		t.Fatalf("Parse: got %v, wanted error", doc)
+	}
+	doc, err := tomledit.ParseOptions{InlineTrailingComma: true}.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		f    tomledit.Formatter
+		want string
+	}{
+		{tomledit.Formatter{}, "a = {x = 1, y = {z = 2}}\nb = {}"},
+		{tomledit.Formatter{InlineTrailingComma: true}, "a = {x = 1, y = {z = 2,},}\nb = {}"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := test.f.Format(&buf, doc); err != nil {
+			t.Fatalf("Format: %v", err)
+		}
+		if diff := cmp.Diff(test.want, strings.TrimSpace(buf.String())); diff != "" {
+			t.Errorf("Format %+v: (-want, +got)\n%s", test.f, diff)
+		}
+	}
+}
+
+func TestEntryFormat(t *testing.T) {
+	doc := mustParse(t, testDoc)
+	tests := []struct {
+		key  []string
+		want string
+	}{
+		{[]string{"p"}, "# top-level mapping\np = {q = [], r = {}}\n"},
+		{[]string{"p", "r"}, "r = {}\n"},
+		{[]string{"first", "table", "x"}, "x = 14  # hey what's up\n"},
+		{[]string{"second-table"}, "[second-table]\nfoo = 'bar'\n"},
+		{[]string{"first", "table", "list"}, "list = [10, 20, 30, 40]\n"},
+	}
+	for _, test := range tests {
+		e := doc.First(test.key...)
+		if e == nil {
+			t.Fatalf("Key %q not found", test.key)
+		}
+		if diff := cmp.Diff(test.want, e.Format()); diff != "" {
+			t.Errorf("Format %q: (-want, +got)\n%s", test.key, diff)
+		}
+	}
+
+	glob := &tomledit.Entry{Section: doc.Global}
+	const want = "# free 1 line 1\n# free 1 line 2\n\n# free 2\n\n# top-level mapping\np = {q = [], r = {}}\n"
+	if diff := cmp.Diff(want, glob.Format()); diff != "" {
+		t.Errorf("Format global: (-want, +got)\n%s", diff)
+	}
+}
+
+func TestFloatExponent(t *testing.T) {
+	doc := mustParse(t, `a = [3.2e+19, 3.2E19, 1e-6, 2.5, inf, -nan]
+b = {c = 6.02E23}
+d = "1e5"
+`)
+	tests := []struct {
+		f    tomledit.Formatter
+		want string
+	}{
+		{tomledit.Formatter{},
+			"a = [3.2e+19, 3.2E19, 1e-6, 2.5, inf, -nan]\nb = {c = 6.02E23}\nd = \"1e5\""},
+		{tomledit.Formatter{FloatExponentCase: tomledit.ExponentLower},
+			"a = [3.2e+19, 3.2e19, 1e-6, 2.5, inf, -nan]\nb = {c = 6.02e23}\nd = \"1e5\""},
+		{tomledit.Formatter{FloatExponentCase: tomledit.ExponentUpper, FloatExplicitPlus: true},
+			"a = [3.2E+19, 3.2E+19, 1E-6, 2.5, inf, -nan]\nb = {c = 6.02E+23}\nd = \"1e5\""},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := test.f.Format(&buf, doc); err != nil {
+			t.Fatalf("Format: %v", err)
+		}
+		if diff := cmp.Diff(test.want, strings.TrimSpace(buf.String())); diff != "" {
+			t.Errorf("Format %+v: (-want, +got)\n%s", test.f, diff)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	doc := mustParse(t, `a = "one\ttwo"
+b = 'lit\n'
+n = 5
+
+[t]
+c = [
+  # comment
+  "x",
+  ["y", 1, 'z'],
+]
+d = {e = "f", g = {h = "i"}}
+m = """
+line one \
+    continued\\
+end"""
+l = '''
+raw\'''
+`)
+	type ref struct {
+		Key   string
+		Index []int
+		Value string
+	}
+	var got []ref
+	refs := doc.Strings()
+	for _, r := range refs {
+		got = append(got, ref{r.Key.String(), r.Index, r.Value})
+	}
+	want := []ref{
+		{"a", nil, "one\ttwo"},
+		{"b", nil, `lit\n`},
+		{"t.c", []int{0}, "x"},
+		{"t.c", []int{1, 0}, "y"},
+		{"t.c", []int{1, 2}, "z"},
+		{"t.d.e", nil, "f"},
+		{"t.d.g.h", nil, "i"},
+		{"t.m", nil, "line one continued\\\nend"},
+		{"t.l", nil, `raw\`},
+	}
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); diff != "" {
+		t.Fatalf("Strings: (-want, +got)\n%s", diff)
+	}
+
+	for _, r := range refs {
+		r.Set(strings.ToUpper(r.Value))
+	}
+	var buf bytes.Buffer
+	if err := tomledit.Format(&buf, doc); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	const wantText = `a = "ONE\tTWO"
+b = "LIT\\N"
+n = 5
+
+[t]
+c = [
+  # comment
+  "X",
+  ["Y", 1, "Z"],
+]
+d = {e = "F", g = {h = "I"}}
+m = """LINE ONE CONTINUED\\
+END"""
+l = """RAW\\"""`
+	if diff := cmp.Diff(wantText, strings.TrimSpace(buf.String())); diff != "" {
+		t.Errorf("Updated: (-want, +got)\n%s", diff)
+	}
+}
+
+func TestEachValue(t *testing.T) {
+	doc := mustParse(t, `a = 1
+b = [2, 3]  # keep
+[t]
+c = {d = 4, e = {f = 5}}
+g = [6, 7]
+`)
+	var keys []string
+	n := doc.EachValue(func(key parser.Key, v parser.Value) (parser.Value, bool) {
+		keys = append(keys, key.String()+"="+v.String())
+		if tok, ok := v.X.(parser.Token); ok && tok.Type == scanner.Integer {
+			return parser.MustValue(v.String() + "0").WithComment(v.Trailer), true
+		}
+		if key.Equals(parser.Key{"t", "g"}) {
+			return parser.MustValue("true"), true
+		}
+		return v, false
+	})
+	if n != 6 {
+		t.Errorf("EachValue: got %d replacements, want 6", n)
+	}
+	wantKeys := []string{
+		"a=1", "b=[2, 3]", "b=2", "b=3",
+		"t.c={d = 4, e = {f = 5}}", "t.c.d=4", "t.c.e={f = 5}", "t.c.e.f=5",
+		"t.g=[6, 7]",
+	}
+	if diff := cmp.Diff(wantKeys, keys); diff != "" {
+		t.Errorf("Visited: (-want, +got)\n%s", diff)
+	}
+
+	var buf bytes.Buffer
+	if err := tomledit.Format(&buf, doc); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	const want = `a = 10
+b = [20, 30]  # keep
+
+[t]
+c = {d = 40, e = {f = 50}}
+g = true`
+	if diff := cmp.Diff(want, strings.TrimSpace(buf.String())); diff != "" {
+		t.Errorf("Wrong output: (-want, +got)\n%s", diff)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	doc := mustParse(t, `a = "30s"
+b = '1h15m'
+c = 30
+d = "soon"
+e = {f = "5m"}
+`)
+	tests := []struct {
+		key  string
+		want time.Duration
+		ok   bool
+	}{
+		{"a", 30 * time.Second, true},
+		{"b", 75 * time.Minute, true},
+		{"c", 0, false},
+		{"d", 0, false},
+		{"e.f", 5 * time.Minute, true},
+		{"nonesuch", 0, false},
+	}
+	for _, test := range tests {
+		key, err := parser.ParseKey(test.key)
+		if err != nil {
+			t.Fatalf("ParseKey: %v", err)
+		}
+		got, err := doc.First(key...).Duration()
+		if (err == nil) != test.ok {
+			t.Errorf("Duration %q: got err=%v, want ok=%v", test.key, err, test.ok)
+		} else if got != test.want {
+			t.Errorf("Duration %q: got %v, want %v", test.key, got, test.want)
+		}
+	}
+
+	doc.First("c").Value = parser.DurationValue(90 * time.Second)
+	if got, err := doc.First("c").Duration(); err != nil || got != 90*time.Second {
+		t.Errorf("Duration c: got %v, %v; want 1m30s", got, err)
+	}
+	if got := doc.First("c").Value.String(); got != `"1m30s"` {
+		t.Errorf("DurationValue: got %s, want %q", got, "1m30s")
+	}
+}
+
+func TestFormatSectionOrder(t *testing.T) {
+	const input = `[a]
+x = 1
+
+[[b]]
+y = 1
+
+[a.c]
+z = 1
+
+[[b]]
+y = 2
+`
+	doc := mustParse(t, input)
+	check := func(t *testing.T, want string) {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := tomledit.Format(&buf, doc); err != nil {
+			t.Fatalf("Format: %v", err)
+		}
+		if diff := cmp.Diff(want, buf.String()); diff != "" {
+			t.Errorf("Format: (-want, +got)\n%s", diff)
+		}
+	}
+
+	// Parsing and formatting must preserve the interleaving of the input.
+	check(t, input)
+
+	// Formatting must respect an explicit reordering of the sections.
+	s := doc.Sections
+	doc.Sections = []*tomledit.Section{s[3], s[2], s[0], s[1]}
+	check(t, `[[b]]
+y = 2
+
+[a.c]
+z = 1
+
+[a]
+x = 1
+
+[[b]]
+y = 1
+`)
+}
+
+func TestNumericKeys(t *testing.T) {
+	const input = `0 = "zero"
+007 = 7
+1234 = "x"
+table.1 = true
+
+[ids.42]
+01 = 3
+
+[[2.007]]
+0 = []
+`
+	doc := mustParse(t, input)
+	for _, key := range []parser.Key{{"007"}, {"table", "1"}, {"ids", "42", "01"}, {"2", "007", "0"}} {
+		if doc.First(key...) == nil {
+			t.Errorf("Key %q not found", key)
+		}
+	}
+	var buf bytes.Buffer
+	if err := tomledit.Format(&buf, doc); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	if diff := cmp.Diff(input, buf.String()); diff != "" {
+		t.Errorf("Format: (-want, +got)\n%s", diff)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	doc := mustParse(t, `b64 = "aGVsbG8/Pz4+"
+url = 'aGVsbG8_Pz4-'
+hex = "68656c6c6f"
+num = 5
+bad = "not base64!"
+`)
+	const want = "hello??>>"
+	tests := []struct {
+		key  string
+		enc  parser.Encoding
+		want string
+		ok   bool
+	}{
+		{"b64", parser.Base64, want, true},
+		{"url", parser.Base64URL, want, true},
+		{"hex", parser.Hex, "hello", true},
+		{"b64", parser.Base64URL, "", false},
+		{"num", parser.Hex, "", false},
+		{"bad", parser.Base64, "", false},
+		{"nonesuch", parser.Hex, "", false},
+	}
+	for _, test := range tests {
+		got, err := doc.First(test.key).Bytes(test.enc)
+		if (err == nil) != test.ok {
+			t.Errorf("Bytes %q: got err=%v, want ok=%v", test.key, err, test.ok)
+		} else if string(got) != test.want {
+			t.Errorf("Bytes %q: got %q, want %q", test.key, got, test.want)
+		}
+	}
+
+	for _, enc := range []parser.Encoding{parser.Base64, parser.Base64URL, parser.Hex} {
+		v, err := parser.BytesValue([]byte(want), enc)
+		if err != nil {
+			t.Fatalf("BytesValue %v: unexpected error: %v", enc, err)
+		}
+		doc.First("num").Value = v
+		if got, err := doc.First("num").Bytes(enc); err != nil || string(got) != want {
+			t.Errorf("BytesValue %v: got %q, %v; want %q", enc, got, err, want)
+		}
+	}
+
+	const badEnc = parser.Hex + 1
+	if v, err := parser.BytesValue([]byte(want), badEnc); err == nil {
+		t.Errorf("BytesValue %v: got %v, want error", badEnc, v)
+	}
+	if got, err := badEnc.Decode("00"); err == nil {
+		t.Errorf("Decode %v: got %q, want error", badEnc, got)
+	}
+}
+
+func TestFormatMinimal(t *testing.T) {
+	const input = `
+# Header comment.
+
+name   =   "demo"   # odd spacing
+list = [ 1,
+   2, 3 ]
+
+[ server ]
+  # The port.
+  port=80
+  host = 'localhost'
+
+
+[[peer]]
+id=1
+`
+	tests := []struct {
+		desc string
+		edit func(*tomledit.Document)
+		want string
+	}{
+		{"NoChange", func(*tomledit.Document) {}, input},
+		{"SetValue", func(doc *tomledit.Document) {
+			doc.First("server", "port").Value.X = parser.MustValue("8080").X
+		}, strings.Replace(input, "  port=80\n", "port = 8080\n", 1)},
+		{"Remove", func(doc *tomledit.Document) {
+			doc.First("server", "host").Remove()
+		}, strings.Replace(input, "  host = 'localhost'\n", "", 1)},
+		{"Append", func(doc *tomledit.Document) {
+			s := doc.First("peer").Section
+			s.Items = append(s.Items, &parser.KeyValue{Name: parser.Key{"ok"}, Value: parser.MustValue("true")})
+		}, input + "ok = true\n"},
+		{"AddSection", func(doc *tomledit.Document) {
+			doc.Sections = append(doc.Sections, &tomledit.Section{
+				Heading: &parser.Heading{Name: parser.Key{"new"}},
+			})
+		}, input + "\n[new]\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			doc := mustParse(t, input)
+			test.edit(doc)
+			var buf bytes.Buffer
+			if err := tomledit.FormatMinimal(&buf, []byte(input), doc); err != nil {
+				t.Fatalf("FormatMinimal: %v", err)
+			}
+			if diff := cmp.Diff(test.want, buf.String()); diff != "" {
+				t.Errorf("FormatMinimal: (-want, +got)\n%s", diff)
+			}
+			mustParse(t, buf.String())
+		})
+	}
+}
+
+func TestToMap(t *testing.T) {
+	doc := mustParse(t, `# Comments are dropped.
+title = "example"
+owner.name = 'Tom'
+
+[server]
+port = 0x1F90
+ratio = 1_000.5
+enabled = true
+tags = ["a", [1, 2]]
+limits = {cpu = 2, mem.max = "1G"}
+when = 1979-05-27T07:32:00Z
+day = 1979-05-27
+
+[server.tls]
+cert = """
+/etc/cert"""
+
+[[product]]
+name = "hammer"
+
+[[product]]
+name = "nail"
+
+[product.size]
+len = 2.5
+
+[owner.extra]
+x = 1
+`)
+	got, err := doc.ToMap()
+	if err != nil {
+		t.Fatalf("ToMap: unexpected error: %v", err)
+	}
+	want := map[string]any{
+		"title": "example",
+		"owner": map[string]any{
+			"name":  "Tom",
+			"extra": map[string]any{"x": int64(1)},
+		},
+		"server": map[string]any{
+			"port":    int64(8080),
+			"ratio":   1000.5,
+			"enabled": true,
+			"tags":    []any{"a", []any{int64(1), int64(2)}},
+			"limits": map[string]any{
+				"cpu": int64(2),
+				"mem": map[string]any{"max": "1G"},
+			},
+			"when": time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC),
+			"day":  time.Date(1979, 5, 27, 0, 0, 0, 0, time.UTC),
+			"tls":  map[string]any{"cert": "/etc/cert"},
+		},
+		"product": []map[string]any{
+			{"name": "hammer"},
+			{"name": "nail", "size": map[string]any{"len": 2.5}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ToMap: (-want, +got)\n%s", diff)
+	}
+
+	for _, bad := range []string{
+		"a = 1\na = 2",
+		"a = 1\n[a.b]\nc = 2",
+		"[a]\nb = 1\n[[a]]\nc = 2",
+		"a = 1\n[[a]]\nc = 2",
+		"[a]\nb = 1\n[a]\nc = 2",
+		"[a]\n[a]",
+		"a = {b = 1}\n[a]\nc = 2",
+		"a = {b = 1}\n[a.c]",
+		"a.b = 1\n[a]\nc = 2",
+	} {
+		doc, err := tomledit.Parse(strings.NewReader(bad))
+		if err != nil {
+			continue // rejected by the parser
+		}
+		if m, err := doc.ToMap(); err == nil {
+			t.Errorf("ToMap(%q): got %v, want error", bad, m)
+		}
+	}
+
+	t.Run("NoPosition", func(t *testing.T) {
+		tab := func() *tomledit.Section {
+			return &tomledit.Section{Heading: &parser.Heading{Name: parser.Key{"a"}}}
+		}
+		doc := &tomledit.Document{Sections: []*tomledit.Section{tab(), tab()}}
+		m, err := doc.ToMap()
+		if err == nil {
+			t.Fatalf("ToMap: got %v, want error", m)
+		}
+		if msg := err.Error(); strings.Contains(msg, "0:0") || strings.Contains(msg, "line 0") {
+			t.Errorf("ToMap: error %q reports an invalid position", msg)
+		}
+	})
+}
+
+func TestFromValue(t *testing.T) {
+	type TLS struct {
+		Cert string `toml:"cert"`
+	}
+	type Server struct {
+		Host string   `toml:"host"`
+		Port int      `toml:"port"`
+		TLS  *TLS     `toml:"tls"`
+		Tags []string `toml:"tags,omitempty"`
+	}
+	type Common struct {
+		Version int `toml:"version"`
+	}
+	type Product struct {
+		Name  string         `toml:"name"`
+		Attrs map[string]any `toml:"attrs"`
+	}
+	type Config struct {
+		Common
+		Title    string             `toml:"title"`
+		When     time.Time          `toml:"when"`
+		Point    struct{ X, Y int } `toml:"-"`
+		Server   Server             `toml:"server"`
+		Products []Product          `toml:"product"`
+		Limits   []map[string]int   `toml:"limits"`
+		Extra    map[string]any
+		Note     *string
+		hidden   int
+	}
+	doc, err := tomledit.FromValue(&Config{
+		Common: Common{Version: 2},
+		Title:  "example",
+		When:   time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC),
+		Server: Server{Host: "localhost", Port: 8080, TLS: &TLS{Cert: "/etc/cert"}},
+		Products: []Product{
+			{Name: "hammer", Attrs: map[string]any{"weight": 1.5, "pos": struct{ X, Y int }{1, 2}}},
+			{Name: "nail", Attrs: map[string]any{"list": []any{struct{ X, Y int }{3, 4}, 5}}},
+			{Name: "nail"},
+		},
+		Extra:  map[string]any{"b": []any{1, "two"}, "a": map[string]any{"c": map[string]any{"d": true}}},
+		hidden: 1,
+	})
+	if err != nil {
+		t.Fatalf("FromValue: unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tomledit.Format(&buf, doc); err != nil {
+		t.Fatalf("Format: unexpected error: %v", err)
+	}
+	const want = `version = 2
+title = "example"
+when = 1979-05-27T07:32:00Z
+
+[server]
+host = "localhost"
+port = 8080
+
+[server.tls]
+cert = "/etc/cert"
+
+[Extra]
+b = [1, "two"]
+
+[Extra.a.c]
+d = true
+
+[[product]]
+name = "hammer"
+
+[product.attrs]
+weight = 1.5
+
+[product.attrs.pos]
+X = 1
+Y = 2
+
+[[product]]
+name = "nail"
+
+[product.attrs]
+list = [
+  {X = 3, Y = 4},
+  5,
+]
+
+[[product]]
+name = "nail"
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Format: (-want, +got)\n%s", diff)
+	}
+
+	// Verify that the output round-trips through the parser.
+	m1, err := doc.ToMap()
+	if err != nil {
+		t.Fatalf("ToMap: unexpected error: %v", err)
+	}
+	m2, err := mustParse(t, buf.String()).ToMap()
+	if err != nil {
+		t.Fatalf("ToMap: unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(m1, m2); diff != "" {
+		t.Errorf("Round trip: (-want, +got)\n%s", diff)
+	}
+
+	for _, bad := range []any{nil, 5, []int{1}, map[int]string{1: "a"}, map[string]any{"c": make(chan int)}} {
+		if doc, err := tomledit.FromValue(bad); err == nil {
+			t.Errorf("FromValue(%v): got %v, want error", bad, doc)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	type TLS struct {
+		Cert string
+	}
+	type Server struct {
+		Host    string        `toml:"host"`
+		Port    uint16        `toml:"port"`
+		Timeout time.Duration `toml:"timeout"`
+		TLS     *TLS          `toml:"tls"`
+		Ratio   float32
+	}
+	type Common struct {
+		Version int `toml:"version"`
+	}
+	type Product struct {
+		Name string    `toml:"name"`
+		Tags [2]string `toml:"tags"`
+	}
+	type Config struct {
+		*Common
+		Title    string         `toml:"title"`
+		When     time.Time      `toml:"when"`
+		Server   Server         `toml:"server"`
+		Products []*Product     `toml:"product"`
+		Extra    map[string]any `toml:"extra"`
+		Sizes    []int64
+		Skip     int `toml:"-"`
+	}
+	doc := mustParse(t, `
+version = 3
+title = "example"
+when = 1979-05-27T07:32:00Z
+sizes = [1, 2, 3]
+skip = 5
+unknown = true
+
+[server]
+host = "localhost"
+port = 8080
+timeout = "1m30s"
+ratio = 2
+tls.cert = "/etc/cert"
+
+[[product]]
+name = "hammer"
+tags = ["a", "b"]
+
+[[product]]
+name = "nail"
+
+[extra]
+a = [1, "two"]
+b.c = 1.5
+`)
+	var got Config
+	if err := doc.Decode(&got); err != nil {
+		t.Fatalf("Decode: unexpected error: %v", err)
+	}
+	want := Config{
+		Common: &Common{Version: 3},
+		Title:  "example",
+		When:   time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC),
+		Server: Server{
+			Host:    "localhost",
+			Port:    8080,
+			Timeout: 90 * time.Second,
+			TLS:     &TLS{Cert: "/etc/cert"},
+			Ratio:   2,
+		},
+		Products: []*Product{{Name: "hammer", Tags: [2]string{"a", "b"}}, {Name: "nail"}},
+		Extra: map[string]any{
+			"a": []any{int64(1), "two"},
+			"b": map[string]any{"c": 1.5},
+		},
+		Sizes: []int64{1, 2, 3},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Decode: (-want, +got)\n%s", diff)
+	}
+
+	t.Run("Strict", func(t *testing.T) {
+		err := tomledit.DecodeOptions{DisallowUnknownKeys: true}.Decode(doc, new(Config))
+		if err == nil || !strings.Contains(err.Error(), `"unknown"`) || !strings.Contains(err.Error(), `"skip"`) {
+			t.Errorf("Decode: got error %v, want unknown keys", err)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		var cfg struct {
+			A int8
+			B uint
+			C string
+			D []int
+			E struct{ F bool }
+			G [1]int
+			H time.Duration
+		}
+		doc := mustParse(t, `a = 300
+b = -1
+c = 5
+d = {x = 1}
+e = [true]
+g = [1, 2]
+h = "forever"
+`)
+		err := doc.Decode(&cfg)
+		if err == nil {
+			t.Fatal("Decode: got nil, want error")
+		}
+		for _, key := range []string{"a", "b", "c", "d", "e", "g", "h"} {
+			if !strings.Contains(err.Error(), fmt.Sprintf("key %q", key)) {
+				t.Errorf("Decode: error does not mention key %q: %v", key, err)
+			}
+		}
+		if err := doc.Decode(cfg); err == nil {
+			t.Error("Decode of a non-pointer: got nil, want error")
+		}
+	})
+}
+
+func TestDiff(t *testing.T) {
+	a := mustParse(t, `# Old version.
+name = "app"
+version = 1
+tags = [
+  "a", # first
+  "b",
+]
+limits = {cpu = 2, mem = "1G"}
+gone = true
+
+[server]
+port = 80
+
+[[worker]]
+id = 1
+
+[[worker]]
+id = 2
+`)
+	b := mustParse(t, `
+tags = ["a", "b"]  # comments and layout do not matter
+version = 2
+name = "app"
+limits = {mem = "2G", cpu = 2}
+added = "yes"
+
+[[worker]]
+id = 1
+
+[[worker]]
+id = 3
+
+[[worker]]
+id = 4
+
+[client]
+`)
+	var got []string
+	for _, c := range tomledit.Diff(a, b) {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"modified version = 1 -> 2",
+		`modified limits.mem = "1G" -> "2G"`,
+		"removed gone = true",
+		"removed table server",
+		"removed server.port = 80",
+		"modified worker.id = 2 -> 3",
+		`added added = "yes"`,
+		"added table worker",
+		"added worker.id = 4",
+		"added table client",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Diff: (-want, +got)\n%s", diff)
+	}
+
+	if got := tomledit.Diff(a, a); len(got) != 0 {
+		t.Errorf("Diff(a, a): got %v, want no changes", got)
+	}
+}
+
+func TestFormatIndent(t *testing.T) {
+	doc := mustParse(t, `top = [1, # one
+  2]
+
+# About t.
+[t]
+# About a.
+a = [[1, 2], "x"]
+b = 2
+
+[[u]]
+c = 3
+`)
+	tests := []struct {
+		f    tomledit.Formatter
+		want string
+	}{
+		{tomledit.Formatter{}, `top = [
+  1,  # one
+  2,
+]
+
+# About t.
+[t]
+
+# About a.
+a = [
+  [1, 2],
+  "x",
+]
+b = 2
+
+[[u]]
+c = 3`},
+		{tomledit.Formatter{Indent: "\t", IndentTables: true}, `top = [
+	1,  # one
+	2,
+]
+
+# About t.
+[t]
+
+	# About a.
+	a = [
+		[1, 2],
+		"x",
+	]
+	b = 2
+
+[[u]]
+	c = 3`},
+		{tomledit.Formatter{Indent: "    "}, `top = [
+    1,  # one
+    2,
+]
+
+# About t.
+[t]
+
+# About a.
+a = [
+    [1, 2],
+    "x",
+]
+b = 2
+
+[[u]]
+c = 3`},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := test.f.Format(&buf, doc); err != nil {
+			t.Fatalf("Format: %v", err)
+		}
+		got := strings.TrimSpace(buf.String())
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("Format %+v: (-want, +got)\n%s", test.f, diff)
+		}
+		if _, err := tomledit.Parse(strings.NewReader(got)); err != nil {
+			t.Errorf("Parse formatted output: %v", err)
+		}
+	}
+
+	if err := (tomledit.Formatter{Indent: "--"}).Format(io.Discard, doc); err == nil {
+		t.Error("Format with invalid indent: got nil, want error")
+	}
+}
+
+func TestFormatAlignValues(t *testing.T) {
+	doc := mustParse(t, `a = 1
+long-name = [
+  1, 2,
+]
+"quoted é" = 3  # note
+
+# Block.
+x = 4
+yy = 5
+# free
+
+z = 6
+
+[t]
+k = 1
+kk.sub = 2
+`)
+	const want = `a          = 1
+long-name  = [1, 2]
+"quoted é" = 3  # note
+
+# Block.
+x  = 4
+yy = 5
+
+# free
+
+z = 6
+
+[t]
+k      = 1
+kk.sub = 2`
+	var buf bytes.Buffer
+	if err := (tomledit.Formatter{AlignValues: true}).Format(&buf, doc); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	got := strings.TrimSpace(buf.String())
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Format: (-want, +got)\n%s", diff)
+	}
+	if diff := cmp.Diff(mustToMap(t, doc), mustToMap(t, mustParse(t, got))); diff != "" {
+		t.Errorf("Reparse: (-want, +got)\n%s", diff)
+	}
+}
+
+func mustToMap(t *testing.T, doc *tomledit.Document) map[string]any {
+	t.Helper()
+	m, err := doc.ToMap()
+	if err != nil {
+		t.Fatalf("ToMap: unexpected error: %v", err)
+	}
+	return m
+}
+
+func TestFormatMaxLineWidth(t *testing.T) {
+	doc := mustParse(t, `short = [1, 2, 3]
+long = ["alpha", "bravo", "charlie", "delta"]
+empty = []
+tab = {name = "x", list = ["alpha", "bravo", "charlie"]}
+nest = [
+  ["alpha", "bravo", "charlie", "delta", "echo"],
+  {a = 1},
+]
+`)
+	const want = `short = [1, 2, 3]
+long = [
+  "alpha",
+  "bravo",
+  "charlie",
+  "delta",
+]
+empty = []
+tab = {name = "x", list = [
+  "alpha",
+  "bravo",
+  "charlie",
+]}
+nest = [
+  [
+    "alpha",
+    "bravo",
+    "charlie",
+    "delta",
+    "echo",
+  ],
+  {a = 1},
+]`
+	var buf bytes.Buffer
+	if err := (tomledit.Formatter{MaxLineWidth: 40}).Format(&buf, doc); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	got := strings.TrimSpace(buf.String())
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Format: (-want, +got)\n%s", diff)
+	}
+	if diff := cmp.Diff(mustToMap(t, doc), mustToMap(t, mustParse(t, got))); diff != "" {
+		t.Errorf("Reparse: (-want, +got)\n%s", diff)
+	}
+}
+
+func TestDocumentSet(t *testing.T) {
+	doc := mustParse(t, "a = 1\nb = {c = 2}\n[t]\n[[u]]\nd = 3\n[[u]]\nd = 4\n")
+	if err := doc.Set(parser.Key{"a"}, parser.MustValue("5")); err != nil {
+		t.Errorf("Set a: unexpected error: %v", err)
+	}
+	if err := doc.Set(parser.Key{"b", "c"}, parser.MustValue("'x'")); err != nil {
+		t.Errorf("Set b.c: unexpected error: %v", err)
+	}
+	for _, bad := range []parser.Key{{"nonesuch"}, {"t"}, {"u", "d"}} {
+		if err := doc.Set(bad, parser.MustValue("0")); err == nil {
+			t.Errorf("Set %q: got nil, want error", bad)
+		}
+	}
+	var buf bytes.Buffer
+	if err := tomledit.Format(&buf, doc); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	if got, want := buf.String(), "a = 5\nb = {c = 'x'}\n\n[t]\n\n[[u]]\nd = 3\n\n[[u]]\nd = 4\n"; got != want {
+		t.Errorf("Format: got %q, want %q", got, want)
+	}
+}
+
+func TestDocumentDelete(t *testing.T) {
+	doc := mustParse(t, `a = 1
+b = {c = 2, d = 3}
+
+[t]
+e = 4
+
+[[u]]
+f = 5
+
+[[u]]
+f = 6
+`)
+	for _, key := range []parser.Key{{"a"}, {"b", "c"}, {"t"}} {
+		if !doc.Delete(key) {
+			t.Errorf("Delete %q: got false, want true", key)
+		}
+	}
+	if doc.Delete(parser.Key{"a"}) {
+		t.Error("Delete a again: got true, want false")
+	}
+	if got := doc.DeleteAll(parser.Key{"u", "f"}); got != 2 {
+		t.Errorf("DeleteAll u.f: got %d, want 2", got)
+	}
+	if got := doc.DeleteAll(parser.Key{"u"}); got != 2 {
+		t.Errorf("DeleteAll u: got %d, want 2", got)
+	}
+	if got := doc.DeleteAll(parser.Key{"u"}); got != 0 {
+		t.Errorf("DeleteAll u again: got %d, want 0", got)
+	}
+	var buf bytes.Buffer
+	if err := tomledit.Format(&buf, doc); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	if got, want := buf.String(), "b = {d = 3}\n"; got != want {
+		t.Errorf("Format: got %q, want %q", got, want)
+	}
+}
+
+func TestFindSections(t *testing.T) {
+	doc := mustParse(t, `[[p]]
+x = 1
+
+[p.q]
+
+[r]
+
+[[p]]
+x = 2
+`)
+	for _, tc := range []struct {
+		name parser.Key
+		want []string
+	}{
+		{parser.Key{"p"}, []string{"[[p]]", "[[p]]"}},
+		{parser.Key{"p", "q"}, []string{"[p.q]"}},
+		{parser.Key{"r"}, []string{"[r]"}},
+		{parser.Key{"x"}, nil},
+		{nil, nil},
+	} {
+		var got []string
+		for _, s := range doc.FindSections(tc.name) {
+			got = append(got, s.Heading.String())
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("FindSections %q (-want, +got):\n%s", tc.name, diff)
+		}
+	}
+}
+
+func TestDocumentAdd(t *testing.T) {
+	doc := new(tomledit.Document)
+	if err := doc.Add(nil, parser.Key{"a"}, parser.MustValue("1"), false); err != nil {
+		t.Errorf("Add a: unexpected error: %v", err)
+	}
+	if err := doc.Add(nil, parser.Key{"a"}, parser.MustValue("2"), true); err != nil {
+		t.Errorf("Add a (replace): unexpected error: %v", err)
+	}
+	if err := doc.Add(parser.Key{"t", "u"}, parser.Key{"b", "c"}, parser.MustValue("3"), false); err != nil {
+		t.Errorf("Add t.u.b.c: unexpected error: %v", err)
+	}
+	if err := doc.Add(parser.Key{"t", "u"}, parser.Key{"b", "c"}, parser.MustValue("4"), false); err == nil {
+		t.Error("Add t.u.b.c again: got nil, want error")
+	}
+	if err := doc.Add(parser.Key{"a"}, parser.Key{"x"}, parser.MustValue("5"), false); err == nil {
+		t.Error("Add to a mapping: got nil, want error")
+	}
+	var buf bytes.Buffer
+	if err := tomledit.Format(&buf, doc); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	if got, want := buf.String(), "a = 2\n\n[t.u]\nb.c = 3\n"; got != want {
+		t.Errorf("Format: got %q, want %q", got, want)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	doc := mustParse(t, `# Comment.
+title = "a <b>"
+n = 5
+f = [1.5, inf, nan]
+when = 1979-05-27 07:32:00-07:00
+local = 1979-05-27T07:32:00.5
+day = 1979-05-27
+clock = 07:32:00
+on = {yes = true}
+
+[[p]]
+x = 1
+
+[[p]]
+x = 2
+`)
+	var buf bytes.Buffer
+	if err := doc.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON: unexpected error: %v", err)
+	}
+	const want = `{
+  "clock": "07:32:00",
+  "day": "1979-05-27",
+  "f": [
+    1.5,
+    "inf",
+    "nan"
+  ],
+  "local": "1979-05-27T07:32:00.5",
+  "n": 5,
+  "on": {
+    "yes": true
+  },
+  "p": [
+    {
+      "x": 1
+    },
+    {
+      "x": 2
+    }
+  ],
+  "title": "a <b>",
+  "when": "1979-05-27T07:32:00-07:00"
+}
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("WriteJSON (-want, +got):\n%s", diff)
+	}
+
+	if err := mustParse(t, "a = 1\na = 2\n").WriteJSON(io.Discard); err == nil {
+		t.Error("WriteJSON: got nil, want error for duplicate key")
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	doc, err := tomledit.ParseJSON(strings.NewReader(`{
+  "title": "example",
+  "n": 5, "f": 2.5, "big": 1e300, "ok": true, "none": null,
+  "list": [1, "two", [3]], "b": [1, null], "c": [null, [null]],
+  "server": {"host": "h", "tls": {"on": false}},
+  "peer": [{"id": 1}, null, {"id": 2}]
+}`))
+	if err != nil {
+		t.Fatalf("ParseJSON: unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tomledit.Format(&buf, doc); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	const want = `b = [1]
+big = 1e+300
+c = [[]]
+f = 2.5
+list = [
+  1,
+  "two",
+  [3],
+]
+n = 5
+ok = true
+title = "example"
+
+[server]
+host = "h"
+
+[server.tls]
+on = false
+
+[[peer]]
+id = 1
+
+[[peer]]
+id = 2
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("ParseJSON (-want, +got):\n%s", diff)
+	}
+
+	for _, bad := range []string{``, `[1, 2]`, `null`, `{"a": 1} {}`, `{"a": }`} {
+		if doc, err := tomledit.ParseJSON(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseJSON(%q): got %v, want error", bad, doc)
+		}
+	}
+}
+
+func TestScanErr(t *testing.T) {
+	doc := mustParse(t, `a = 1
+b = "x"
+
+[t]
+c = 2
+`)
+	var keys []string
+	errBad := errors.New("not an integer")
+	err := doc.ScanErr(func(key parser.Key, e *tomledit.Entry) error {
+		keys = append(keys, key.String())
+		if e.IsMapping() {
+			if _, err := e.Value.Int(); err != nil {
+				return fmt.Errorf("%s: %w", key, errBad)
+			}
+		}
+		return nil
+	})
+	if !errors.Is(err, errBad) {
+		t.Errorf("ScanErr: got error %v, want %v", err, errBad)
+	}
+	if diff := cmp.Diff([]string{"a", "b"}, keys); diff != "" {
+		t.Errorf("ScanErr keys (-want, +got):\n%s", diff)
+	}
+
+	keys = nil
+	if err := doc.ScanErr(func(key parser.Key, _ *tomledit.Entry) error {
+		keys = append(keys, key.String())
+		return nil
+	}); err != nil {
+		t.Errorf("ScanErr: unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]string{"a", "b", "t", "t.c"}, keys); diff != "" {
+		t.Errorf("ScanErr keys (-want, +got):\n%s", diff)
+	}
+}
+
+func TestEntryPath(t *testing.T) {
+	doc := mustParse(t, `a = 1
+b = {c = {d = 2}}
+
+[t.u]
+v.w = 3
+
+[[p]]
+x = 4
+`)
+	var entries []*tomledit.Entry
+	var want []string
+	doc.Scan(func(key parser.Key, e *tomledit.Entry) bool {
+		entries = append(entries, e)
+		want = append(want, key.String())
+		return true
+	})
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Path().String())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Entry paths (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"a", "b", "b.c", "b.c.d", "t.u", "t.u.v.w", "p", "p.x"}, got); diff != "" {
+		t.Errorf("Entry paths (-want, +got):\n%s", diff)
+	}
+}
+
+func TestStrictDuplicates(t *testing.T) {
+	strict := tomledit.ParseOptions{StrictDuplicates: true}
+	valid := []string{
+		"a = 1\nb = 2\n",
+		"a.b = 1\na.c = 2\n",
+		"[t]\nx = 1\n[u]\nx = 1\n",
+		"[[p]]\nx = 1\n[[p]]\nx = 2\n",
+		"[[p]]\n[p.q]\nx = 1\n[[p]]\n[p.q]\nx = 2\n",
+		"[a.b]\nx = 1\n[a]\ny = 2\n",
+		"[fruit]\napple.color = 'red'\n[fruit.apple.texture]\nsmooth = true\n",
+		"a = {b = 1, c = {b = 2}}\n",
+	}
+	for _, input := range valid {
+		if _, err := strict.Parse(strings.NewReader(input)); err != nil {
+			t.Errorf("Parse %q: unexpected error: %v", input, err)
+		}
+	}
+
+	tests := []struct {
+		input     string
+		line, col int
+	}{
+		{"a = 1\na = 2\n", 2, 0},
+		{"[t]\nx = 1\n  x = 2\n", 3, 2},
+		{"[t]\n[u]\n[t]\n", 3, 0},
+		{"a = 1\n[a]\n", 2, 0},
+		{"a = 1\na.b = 2\n", 2, 0},
+		{"a.b = 1\n[a]\n", 2, 0},
+		{"[a]\nb = 1\n[a.b]\n", 3, 0},
+		{"[fruit]\napple.color = 'red'\n[fruit.apple]\n", 3, 0},
+		{"[t]\n[[t]]\n", 2, 0},
+		{"[[t]]\n[t]\n", 2, 0},
+		{"a = {b = 1, b = 2}\n", 1, 12},
+		{"a = {b = 1}\n[a]\n", 2, 0},
+		{"[[p]]\nx = 1\nx = 2\n", 3, 0},
+	}
+	for _, tc := range tests {
+		_, err := strict.Parse(strings.NewReader(tc.input))
+		var pe *parser.ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("Parse %q: got %v, want *parser.ParseError", tc.input, err)
+			continue
+		}
+		if pe.Line != tc.line || pe.Column != tc.col {
+			t.Errorf("Parse %q: error at %d:%d, want %d:%d (%v)", tc.input, pe.Line, pe.Column, tc.line, tc.col, err)
+		}
+
+		// Without the strict option, the input is accepted.
+		if _, err := tomledit.Parse(strings.NewReader(tc.input)); err != nil {
+			t.Errorf("Parse %q (lenient): unexpected error: %v", tc.input, err)
+		}
+	}
+}
+
+func TestBlankLines(t *testing.T) {
+	const input = `# Header.
+
+a = 1
+b = 2
+
+c = 3
+
+
+d = 4
+# About e.
+e = 5
+
+[t]
+
+x = 1
+y = [1,
+
+  2]
+
+z = 3
+`
+	doc := mustParse(t, input)
+	var buf bytes.Buffer
+	if err := tomledit.Format(&buf, doc); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	const want = `# Header.
+
+a = 1
+b = 2
+
+c = 3
+
+d = 4
+
+# About e.
+e = 5
+
+[t]
+
+x = 1
+y = [1, 2]
+
+z = 3
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Format (-want, +got):\n%s", diff)
+	}
+
+	// Formatting the output again should not change it.
+	var again bytes.Buffer
+	if err := tomledit.Format(&again, mustParse(t, buf.String())); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	if diff := cmp.Diff(buf.String(), again.String()); diff != "" {
+		t.Errorf("Reformat (-want, +got):\n%s", diff)
+	}
+
+	// Blank lines delimit groups for alignment.
+	buf.Reset()
+	f := tomledit.Formatter{AlignValues: true}
+	if err := f.Format(&buf, mustParse(t, "a = 1\nbbb = 2\n\ncc = 3\nd = 4\n")); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	if diff := cmp.Diff("a   = 1\nbbb = 2\n\ncc = 3\nd  = 4\n", buf.String()); diff != "" {
+		t.Errorf("Format aligned (-want, +got):\n%s", diff)
+	}
+}
+
+func TestFormatStringStyle(t *testing.T) {
+	const input = `a = "basic"
+b = 'literal'
+c = "it's"
+d = "tab\there"
+e = "line\nbreak"
+f = 'C:\path'
+g = """
+multi"""
+h = ["x", 'y']
+i = {z = "w"}
+`
+	tests := []struct {
+		style tomledit.StringStyle
+		want  string
+	}{
+		{tomledit.StringPreserve, input},
+		{tomledit.StringBasic, `a = "basic"
+b = "literal"
+c = "it's"
+d = "tab\there"
+e = "line\nbreak"
+f = "C:\\path"
+g = """
+multi"""
+h = ["x", "y"]
+i = {z = "w"}
+`},
+		{tomledit.StringLiteral, `a = 'basic'
+b = 'literal'
+c = "it's"
+d = 'tab	here'
+e = "line\nbreak"
+f = 'C:\path'
+g = """
+multi"""
+h = ['x', 'y']
+i = {z = 'w'}
+`},
+	}
+	doc := mustParse(t, input)
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		f := tomledit.Formatter{StringStyle: tc.style}
+		if err := f.Format(&buf, doc); err != nil {
+			t.Fatalf("Format: %v", err)
+		}
+		if diff := cmp.Diff(tc.want, buf.String()); diff != "" {
+			t.Errorf("Format style %v (-want, +got):\n%s", tc.style, diff)
+		}
+	}
+}
+
+func TestArrayClosingComments(t *testing.T) {
+	const input = `x = [1, 2, ] # tail
+y = [
+  1, # one
+  2,
+  # note
+] # end
+z = [[1,
+  # inner
+], # nested
+  # outer
+]
+`
+	doc := mustParse(t, input)
+	var buf bytes.Buffer
+	if err := tomledit.Format(&buf, doc); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	const want = `x = [1, 2]  # tail
+y = [
+  1,  # one
+  2,
+  # note
+]  # end
+z = [
+  [
+    1,
+    # inner
+  ],  # nested
+  # outer
+]
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Format (-want, +got):\n%s", diff)
+	}
+
+	// Formatting the output again should not change it.
+	var again bytes.Buffer
+	if err := tomledit.Format(&again, mustParse(t, buf.String())); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	if diff := cmp.Diff(buf.String(), again.String()); diff != "" {
+		t.Errorf("Reformat (-want, +got):\n%s", diff)
+	}
+}
+
+func TestMultilineInline(t *testing.T) {
+	const input = `a = {
+  # About x.
+  x = 1, # one
+  y = {z = 2}
+} # tail
+b = [{p = 3, # three
+  # tail
+}]
+`
+	if doc, err := tomledit.Parse(strings.NewReader(input)); err == nil {
+		t.Fatalf("Parse: got %v, wanted error", doc)
+	}
+	opts := tomledit.ParseOptions{MultilineInline: true, InlineTrailingComma: true}
+	doc, err := opts.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse: unexpected error: %v", err)
+	}
+	t.Run("Default", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := tomledit.Format(&buf, doc); err != nil {
+			t.Fatalf("Format: %v", err)
+		}
+		const want = `a = {x = 1, y = {z = 2}}  # tail
+b = [
+  {p = 3},
+]
+`
+		if diff := cmp.Diff(want, buf.String()); diff != "" {
+			t.Errorf("Format (-want, +got):\n%s", diff)
+		}
+
+		// The output must be accepted by the default parser.
+		if _, err := tomledit.Parse(strings.NewReader(buf.String())); err != nil {
+			t.Errorf("Parse formatted: %v", err)
+		}
+	})
+
+	t.Run("Multiline", func(t *testing.T) {
+		f := tomledit.Formatter{MultilineInline: true}
+		var buf bytes.Buffer
+		if err := f.Format(&buf, doc); err != nil {
+			t.Fatalf("Format: %v", err)
+		}
+		const want = `a = {
+  # About x.
+  x = 1,  # one
+  y = {z = 2}
+}  # tail
+b = [
+  {
+    p = 3  # three
+    # tail
+  },
+]
+`
+		if diff := cmp.Diff(want, buf.String()); diff != "" {
+			t.Errorf("Format (-want, +got):\n%s", diff)
+		}
+
+		// Formatting the output again should not change it.
+		again, err := opts.Parse(strings.NewReader(buf.String()))
+		if err != nil {
+			t.Fatalf("Parse formatted: %v", err)
+		}
+		var buf2 bytes.Buffer
+		if err := f.Format(&buf2, again); err != nil {
+			t.Fatalf("Format: %v", err)
+		}
+		if diff := cmp.Diff(buf.String(), buf2.String()); diff != "" {
+			t.Errorf("Reformat (-want, +got):\n%s", diff)
+		}
+	})
+}
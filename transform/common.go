@@ -4,23 +4,69 @@ package transform
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/creachadair/tomledit"
 	"github.com/creachadair/tomledit/parser"
+	"github.com/creachadair/tomledit/scanner"
 )
 
 // SnakeToKebab transforms all the key names in doc from snake_case to
 // kebab-case. This transformation cannot fail.
 func SnakeToKebab() Func {
+	return mapKeys(false, func(s string) string { return strings.ReplaceAll(s, "_", "-") })
+}
+
+// KebabToSnake transforms all the key names in doc from kebab-case to
+// snake_case. This transformation cannot fail.
+//
+// Only key segments that are valid bare keys are transformed. A segment that
+// must be quoted, such as "a-b c", is taken to be data rather than a name and
+// is not modified. Since the parser does not record whether a segment was
+// quoted, a segment such as "a-b" is transformed even if it was quoted.
+func KebabToSnake() Func {
+	return mapKeys(true, func(s string) string { return strings.ReplaceAll(s, "-", "_") })
+}
+
+// LowercaseKeys transforms all the key names in doc to lower case. As with
+// KebabToSnake, only key segments that are valid bare keys are transformed.
+// This transformation cannot fail.
+func LowercaseKeys() Func { return mapKeys(true, strings.ToLower) }
+
+// UppercaseKeys transforms all the key names in doc to upper case. As with
+// KebabToSnake, only key segments that are valid bare keys are transformed.
+// This transformation cannot fail.
+func UppercaseKeys() Func { return mapKeys(true, strings.ToUpper) }
+
+// mapKeys returns a Func that replaces each segment of the key names in doc
+// with the result of calling f on it. If wordsOnly is true, only segments that
+// are valid bare keys are modified.
+func mapKeys(wordsOnly bool, f func(string) string) Func {
 	return func(_ context.Context, doc *tomledit.Document) error {
+		replace := func(key parser.Key) parser.Key {
+			out := make(parser.Key, len(key))
+			for i, elt := range key {
+				if wordsOnly && !scanner.IsWord(elt) {
+					out[i] = elt
+				} else {
+					out[i] = f(elt)
+				}
+			}
+			return out
+		}
 		doc.Scan(func(key parser.Key, e *tomledit.Entry) bool {
 			if e.IsSection() && !e.IsGlobal() {
-				e.Heading.Name = snakeToKebabKey(e.TableName())
+				e.Heading.Name = replace(e.TableName())
 			}
 			if e.KeyValue != nil {
-				e.KeyValue.Name = snakeToKebabKey(e.KeyValue.Name)
+				e.KeyValue.Name = replace(e.KeyValue.Name)
 			}
 			return true
 		})
@@ -28,14 +74,6 @@ func SnakeToKebab() Func {
 	}
 }
 
-func snakeToKebabKey(key parser.Key) parser.Key {
-	out := make(parser.Key, len(key))
-	for i, elt := range key {
-		out[i] = strings.ReplaceAll(elt, "_", "-")
-	}
-	return out
-}
-
 // Rename renames the section or mapping at oldKey to newKey, and reports
 // whether the rename was successful. The mapping is not moved within the
 // document, only its label is changed.
@@ -81,17 +119,17 @@ func MoveKey(oldKey, rootKey, newKey parser.Key) Func {
 		dst := doc.First(rootKey...)
 		if dst == nil {
 			return fmt.Errorf("root key %q not found", rootKey)
+		} else if !dst.IsSection() && !dst.IsInline() {
+			return fmt.Errorf("target %q is not a table", rootKey)
 		}
 
 		src.Remove()
 		src.Name = newKey
 		if dst.IsSection() {
 			dst.Items = append(dst.Items, src.KeyValue)
-		} else if dst.IsInline() {
+		} else {
 			v := dst.Value.X.(parser.Inline)
 			dst.Value.X = append(v, src.KeyValue)
-		} else {
-			return fmt.Errorf("target %q is not a table", newKey)
 		}
 		return nil
 	}
@@ -110,3 +148,1439 @@ func EnsureKey(table parser.Key, kv *parser.KeyValue) Func {
 		return nil
 	}
 }
+
+// EnsureSection ensures doc contains a table section with the given name,
+// adding an empty section at the end of the document if it does not. Tables
+// implied by a dotted name are not added, so that for example if name is a.b
+// and doc has no table a, only the section [a.b] is added. It reports an error
+// if name is empty, or is already defined as something other than a table
+// section.
+func EnsureSection(name parser.Key) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		if len(name) == 0 {
+			return errors.New("empty table name")
+		}
+		if e := doc.First(name...); e != nil {
+			if !e.IsSection() || e.IsArray {
+				return fmt.Errorf("%q is not a table", name)
+			}
+			return nil
+		}
+		doc.Sections = append(doc.Sections, &tomledit.Section{
+			Heading: &parser.Heading{Name: name},
+		})
+		return nil
+	}
+}
+
+// EnsureKeyPath ensures doc contains a mapping for the given full key, adding
+// one with the given value if it is not already present. An existing mapping
+// is not modified.
+//
+// A key with one element is added to the global table. Otherwise, the mapping
+// is added to the table named by all but the last element of the key if that
+// table exists. If not, it is added with a dotted key to the non-array table
+// whose name is the longest prefix of the key, if there is one. Otherwise, a
+// new section is added to the end of the document to contain the mapping.
+//
+// It reports an error if full is empty, or if some prefix of full is defined
+// as something other than a table, or as an array table. It also reports an
+// error if the mapping would have to be added to an inline table that does not
+// already contain the table named by all but the last element of the key.
+func EnsureKeyPath(full parser.Key, value parser.Value) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		if len(full) == 0 {
+			return errors.New("empty key")
+		}
+		if e := doc.First(full...); e != nil {
+			if e.IsSection() {
+				return fmt.Errorf("%q is a table", full)
+			}
+			return nil
+		}
+		// Check that each proper prefix of the key, if defined, is a table to
+		// which the mapping can be added.
+		var inline parser.Key // the longest prefix defined as an inline table
+		for i := 1; i < len(full); i++ {
+			e := doc.First(full[:i]...)
+			if e == nil {
+				continue
+			} else if e.IsSection() && e.IsArray {
+				return fmt.Errorf("%q is an array table", full[:i])
+			} else if e.IsMapping() {
+				if _, ok := e.Value.X.(parser.Inline); !ok {
+					return fmt.Errorf("%q is not a table", full[:i])
+				}
+				inline = full[:i]
+			}
+		}
+
+		kv := &parser.KeyValue{Name: full[len(full)-1:], Value: value}
+		if len(full) == 1 {
+			if doc.Global == nil {
+				doc.Global = new(tomledit.Section)
+			}
+			InsertMapping(doc.Global, kv, false)
+			return nil
+		}
+
+		tab := full[:len(full)-1]
+		if e := doc.First(tab...); e == nil {
+			// No table with this name; fall through to the search below.
+		} else if e.IsMapping() {
+			in, ok := e.Value.X.(parser.Inline)
+			if !ok {
+				return fmt.Errorf("%q is not a table", tab)
+			}
+			e.Value.X = append(in, kv)
+			return nil
+		} else {
+			InsertMapping(e.Section, kv, false)
+			return nil
+		}
+
+		// An inline table cannot be extended outside its braces.
+		if inline != nil {
+			return fmt.Errorf("%q is an inline table without %q", inline, tab)
+		}
+		if s := longestTablePrefix(doc, full); s != nil {
+			kv.Name = append(parser.Key(nil), full[len(s.TableName()):]...)
+			InsertMapping(s, kv, false)
+			return nil
+		}
+		doc.Sections = append(doc.Sections, &tomledit.Section{
+			Heading: &parser.Heading{Name: append(parser.Key(nil), tab...)},
+			Items:   []parser.Item{kv},
+		})
+		return nil
+	}
+}
+
+// ConsolidateDotted moves each dotted mapping in the global table whose key
+// prefix names an existing (non-array) table into that table, with the
+// remainder of the key as its name. Comments attached to a mapping move with
+// it. If more than one table matches, the longest matching prefix is chosen.
+//
+// Moved mappings are added to the end of the target table in their original
+// relative order. It reports an error if a moved mapping would duplicate a key
+// already defined in the target table; such mappings are left in place.
+func ConsolidateDotted() Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		if doc.Global == nil {
+			return nil
+		}
+		var keep []parser.Item
+		var dups []string
+		for _, item := range doc.Global.Items {
+			kv, ok := item.(*parser.KeyValue)
+			if !ok || len(kv.Name) < 2 {
+				keep = append(keep, item)
+				continue
+			}
+			tab := longestTablePrefix(doc, kv.Name)
+			if tab == nil {
+				keep = append(keep, item)
+				continue
+			}
+			moved := *kv
+			moved.Name = append(parser.Key(nil), kv.Name[len(tab.TableName()):]...)
+			if !InsertMapping(tab, &moved, false) {
+				dups = append(dups, kv.Name.String())
+				keep = append(keep, item)
+			}
+		}
+		doc.Global.Items = keep
+		if len(dups) != 0 {
+			return fmt.Errorf("duplicate keys not moved: %q", dups)
+		}
+		return nil
+	}
+}
+
+// longestTablePrefix returns the first non-array table in doc whose name is
+// the longest proper prefix of key, or nil if there is none.
+func longestTablePrefix(doc *tomledit.Document, key parser.Key) *tomledit.Section {
+	var best *tomledit.Section
+	for _, s := range doc.Sections {
+		name := s.TableName()
+		if s.IsArray || len(name) >= len(key) || !name.IsPrefixOf(key) {
+			continue
+		}
+		if best == nil || len(name) > len(best.TableName()) {
+			best = s
+		}
+	}
+	return best
+}
+
+// EnvOverride replaces the values of existing mappings in doc with values
+// from the environment. For each mapping, the name of the corresponding
+// variable is prefix followed by the full key in upper snake case, so that
+// with prefix "APP_" the key server.port corresponds to APP_SERVER_PORT.
+// Characters in the key that are not letters or digits are replaced by "_".
+//
+// The lookup function reports the value of a variable and whether it is set;
+// os.LookupEnv is a suitable implementation.  Values must be in TOML syntax,
+// and are parsed with parser.ParseValue. Mappings whose variables are not set
+// are left unchanged, and no new mappings are added. All overrides are
+// attempted before reporting an error for any values that do not parse.
+func EnvOverride(prefix string, lookup func(string) (string, bool)) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		var bad []string
+		doc.Scan(func(key parser.Key, e *tomledit.Entry) bool {
+			if !e.IsMapping() {
+				return true
+			}
+			name := prefix + envName(key)
+			text, ok := lookup(name)
+			if !ok {
+				return true
+			}
+			v, err := parser.ParseValue(text)
+			if err != nil {
+				bad = append(bad, name)
+				return true
+			}
+			if v.Trailer == "" {
+				v.Trailer = e.Value.Trailer
+			}
+			e.Value = v
+			return true
+		})
+		if len(bad) != 0 {
+			return fmt.Errorf("invalid values for %q", bad)
+		}
+		return nil
+	}
+}
+
+// envName converts key into an upper snake case variable name.
+func envName(key parser.Key) string {
+	return strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' {
+			return r - 'a' + 'A'
+		} else if 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			return r
+		}
+		return '_'
+	}, strings.Join(key, "."))
+}
+
+// TrimTrailingSpace removes trailing whitespace from all the lines of comments
+// in doc, and rewrites multi-line string values so that none of their lines
+// ends in whitespace, without changing the content of the strings.
+//
+// In a multi-line basic string, whitespace at the end of a line is replaced by
+// escape sequences, except after a line-ending backslash, where it is removed.
+// A multi-line literal string with trailing whitespace is converted to a
+// multi-line basic string, since literal strings do not permit escapes.
+//
+// The Formatter trims whitespace from comments on output, but copies string
+// values verbatim.  After applying this transformation, no line of the
+// formatted output of doc will end in whitespace.
+func TrimTrailingSpace() Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		for _, s := range allSections(doc) {
+			if s.Heading != nil {
+				s.Heading.Block = trimComments(s.Heading.Block)
+				s.Heading.Trailer = strings.TrimSpace(s.Heading.Trailer)
+			}
+			for i, item := range s.Items {
+				switch t := item.(type) {
+				case parser.Comments:
+					s.Items[i] = trimComments(t)
+				case *parser.KeyValue:
+					t.Block = trimComments(t.Block)
+				}
+			}
+		}
+		var err error
+		walkValues(doc, func(v *parser.Value) {
+			v.Trailer = strings.TrimSpace(v.Trailer)
+			switch t := v.X.(type) {
+			case parser.Array:
+				for i, elt := range t {
+					if c, ok := elt.(parser.Comments); ok {
+						t[i] = trimComments(c)
+					}
+				}
+			case parser.Token:
+				if t.Type != scanner.MString && t.Type != scanner.MLString {
+					return
+				}
+				text := t.String()
+				body := text[3 : len(text)-3]
+				if t.Type == scanner.MLString {
+					if !hasTrailingSpace(body) {
+						return
+					}
+					body = string(scanner.EscapeMultiline(body))
+				}
+				fixed := `"""` + escapeTrailingSpace(body) + `"""`
+				if fixed == text {
+					return
+				}
+				nv, perr := parser.ParseValue(fixed)
+				if perr != nil {
+					if err == nil {
+						err = fmt.Errorf("rewriting string: %w", perr)
+					}
+					return
+				}
+				v.X = nv.X
+			}
+		})
+		return err
+	}
+}
+
+// CommentKind is a set of kinds of comments, for StripCommentsOf.
+type CommentKind int
+
+// Constants defining the kinds of comments.
+const (
+	// Block comments attached to headings and mappings, free-standing comment
+	// blocks, and comment lines inside arrays.
+	BlockComments CommentKind = 1 << iota
+
+	// Trailing line comments after headings and values, including the values
+	// of arrays.
+	TrailingComments
+
+	AllComments = BlockComments | TrailingComments
+)
+
+// StripComments removes all comments from doc. It is equivalent to
+// StripCommentsOf(AllComments). This transformation cannot fail.
+func StripComments() Func { return StripCommentsOf(AllComments) }
+
+// StripCommentsOf removes from doc all comments of the specified kinds. This
+// transformation cannot fail.
+func StripCommentsOf(kinds CommentKind) Func {
+	block, trailing := kinds&BlockComments != 0, kinds&TrailingComments != 0
+	return func(_ context.Context, doc *tomledit.Document) error {
+		for _, s := range allSections(doc) {
+			if s.Heading != nil {
+				if block {
+					s.Heading.Block = nil
+				}
+				if trailing {
+					s.Heading.Trailer = ""
+				}
+			}
+			if block {
+				s.Items = slices.DeleteFunc(s.Items, func(item parser.Item) bool {
+					if kv, ok := item.(*parser.KeyValue); ok {
+						kv.Block = nil
+						return false
+					}
+					_, isCom := item.(parser.Comments)
+					return isCom
+				})
+			}
+		}
+		walkValues(doc, func(v *parser.Value) {
+			if trailing {
+				v.Trailer = ""
+			}
+			if arr, ok := v.X.(parser.Array); ok && block {
+				v.X = slices.DeleteFunc(arr, func(elt parser.ArrayItem) bool {
+					_, isCom := elt.(parser.Comments)
+					return isCom
+				})
+			}
+		})
+		return nil
+	}
+}
+
+// trimComments returns a copy of c with trailing whitespace removed from each
+// line of each comment.
+func trimComments(c parser.Comments) parser.Comments {
+	if len(c) == 0 {
+		return c
+	}
+	out := make(parser.Comments, len(c))
+	for i, text := range c {
+		lines := strings.Split(text, "\n")
+		for j, line := range lines {
+			lines[j] = strings.TrimRight(line, " \t\r")
+		}
+		out[i] = strings.Join(lines, "\n")
+	}
+	return out
+}
+
+// hasTrailingSpace reports whether any line of s prior to the last one ends
+// with whitespace.
+func hasTrailingSpace(s string) bool {
+	lines := strings.Split(s, "\n")
+	for _, line := range lines[:len(lines)-1] {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimRight(line, " \t") != line {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeTrailingSpace rewrites the body of a multi-line basic string so that
+// no line ends in whitespace, preserving the decoded content of the string.
+func escapeTrailingSpace(body string) string {
+	lines := strings.Split(body, "\n")
+	for i, line := range lines[:len(lines)-1] {
+		cr := strings.HasSuffix(line, "\r")
+		line = strings.TrimSuffix(line, "\r")
+		trim := strings.TrimRight(line, " \t")
+		if trim == line {
+			continue
+		}
+		if n := len(trim) - len(strings.TrimRight(trim, `\`)); n%2 == 1 {
+			// An unescaped line-ending backslash consumes the whitespace.
+			line = trim
+		} else {
+			var buf strings.Builder
+			buf.WriteString(trim)
+			for _, c := range line[len(trim):] {
+				if c == '\t' {
+					buf.WriteString(`\t`)
+				} else {
+					buf.WriteString(`\u0020`)
+				}
+			}
+			line = buf.String()
+		}
+		if cr {
+			line += "\r"
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ExpandLargeInline converts each mapping in doc whose value is an inline table
+// with more than threshold entries into a table section, with the entries of
+// the inline table as its contents. The new section is placed after the
+// section that contained the mapping, and inherits the comments attached to
+// the mapping. Nested inline tables that also exceed the threshold are
+// expanded into sections of their own. This transformation cannot fail.
+func ExpandLargeInline(threshold int) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		expandInlineIf(doc, func(_ *parser.KeyValue, in parser.Inline) bool {
+			return len(in) > threshold
+		})
+		return nil
+	}
+}
+
+// ExpandInline converts the mapping for key, whose value must be an inline
+// table, into a table section as described by ExpandLargeInline. Inline tables
+// nested inside it are also expanded into sections. The mapping is the one
+// found by doc.First, so if key is inside an array table, only the mapping in
+// the first element of the array is converted. It reports an error if key is
+// not found, or if its value is not an inline table.
+func ExpandInline(key parser.Key) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		e := doc.First(key...)
+		if e == nil || !e.IsMapping() {
+			return fmt.Errorf("no mapping found for key %q", key)
+		} else if _, ok := e.Value.X.(parser.Inline); !ok {
+			return fmt.Errorf("value of %q is not an inline table", key)
+		} else if e.IsInline() {
+			return fmt.Errorf("%q is inside an inline table", key)
+		}
+		// Expand only the mapping found, and the inline tables nested in it,
+		// and not mappings with the same key in other array elements.
+		want := make(map[*parser.KeyValue]bool)
+		var mark func(*parser.KeyValue)
+		mark = func(kv *parser.KeyValue) {
+			want[kv] = true
+			in, _ := kv.Value.X.(parser.Inline)
+			for _, elt := range in {
+				if _, ok := elt.Value.X.(parser.Inline); ok {
+					mark(elt)
+				}
+			}
+		}
+		mark(e.KeyValue)
+		expandInlineIf(doc, func(kv *parser.KeyValue, _ parser.Inline) bool {
+			return want[kv]
+		})
+		return nil
+	}
+}
+
+// ExpandAllInline converts each mapping in doc whose value is an inline table
+// into a table section, as described by ExpandLargeInline. This
+// transformation cannot fail.
+func ExpandAllInline() Func { return ExpandLargeInline(-1) }
+
+// CollapseToInline converts the table section with the given name into an
+// inline table. The new mapping is added to the non-array table whose name is
+// the longest proper prefix of section, with the remainder of the name as its
+// key, or to the global table if there is no such table.
+//
+// Since an inline table cannot contain comments, the block comment of the
+// heading, and all the comments inside the section, are combined in order
+// into the block comment of the new mapping. A trailing comment on the
+// heading becomes the trailing comment of the new mapping.
+//
+// It reports an error if section is not found, is or is inside an array table,
+// contains a value that spans multiple lines, or has nested table sections.
+func CollapseToInline(section parser.Key) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		i := slices.IndexFunc(doc.Sections, func(s *tomledit.Section) bool {
+			return s.TableName().Equals(section)
+		})
+		if i < 0 {
+			return fmt.Errorf("table %q not found", section)
+		}
+		s := doc.Sections[i]
+		if s.IsArray {
+			return fmt.Errorf("table %q is an array table", section)
+		}
+		for _, o := range doc.Sections {
+			name := o.TableName()
+			if len(name) > len(section) && section.IsPrefixOf(name) {
+				return fmt.Errorf("table %q has nested table %q", section, name)
+			} else if o.IsArray && len(name) < len(section) && name.IsPrefixOf(section) {
+				return fmt.Errorf("table %q is inside array table %q", section, name)
+			}
+		}
+
+		block := slices.Clone(s.Heading.Block)
+		var in parser.Inline
+		for _, item := range s.Items {
+			switch t := item.(type) {
+			case parser.Comments:
+				block = append(block, t...)
+			case *parser.KeyValue:
+				if isMultilineDatum(t.Value.X) {
+					return fmt.Errorf("value of %q spans multiple lines", section.Child(t.Name...))
+				}
+				block = append(block, t.Block...)
+				if t.Value.Trailer != "" {
+					block = append(block, t.Value.Trailer)
+				}
+				in = append(in, &parser.KeyValue{Name: t.Name, Value: parser.Value{X: t.Value.X}})
+			}
+		}
+
+		parent := longestTablePrefix(doc, section)
+		if parent == nil {
+			if doc.Global == nil {
+				doc.Global = new(tomledit.Section)
+			}
+			parent = doc.Global
+		}
+		kv := &parser.KeyValue{
+			Block: block,
+			Name:  append(parser.Key(nil), section[len(parent.TableName()):]...),
+			Value: parser.Value{X: in, Trailer: s.Heading.Trailer},
+		}
+		if !InsertMapping(parent, kv, false) {
+			return fmt.Errorf("key %q is already defined", section)
+		}
+		doc.Sections = slices.Delete(doc.Sections, i, i+1)
+		return nil
+	}
+}
+
+// expandInlineIf converts each mapping in doc whose value is an inline table
+// for which pred returns true into a table section. The arguments to pred are
+// the mapping and its value.
+func expandInlineIf(doc *tomledit.Document, pred func(*parser.KeyValue, parser.Inline) bool) {
+	var front, out []*tomledit.Section
+	if doc.Global != nil {
+		front = expandSection(doc.Global, pred)
+	}
+	for _, s := range doc.Sections {
+		out = append(out, s)
+		out = append(out, expandSection(s, pred)...)
+	}
+	doc.Sections = append(front, out...)
+}
+
+// expandSection removes from s each mapping whose value is an inline table
+// matching pred, and returns new sections for them in order.
+func expandSection(s *tomledit.Section, pred func(*parser.KeyValue, parser.Inline) bool) []*tomledit.Section {
+	var keep []parser.Item
+	var added []*tomledit.Section
+	for _, item := range s.Items {
+		kv, ok := item.(*parser.KeyValue)
+		if !ok {
+			keep = append(keep, item)
+			continue
+		}
+		in, ok := kv.Value.X.(parser.Inline)
+		if !ok || !pred(kv, in) {
+			keep = append(keep, item)
+			continue
+		}
+		full := s.TableName().Child(kv.Name...)
+		sub := &tomledit.Section{
+			Heading: &parser.Heading{
+				Block:   kv.Block,
+				Trailer: kv.Value.Trailer,
+				Name:    full,
+			},
+		}
+		for _, elt := range in {
+			if len(elt.Tail) == 0 {
+				sub.Items = append(sub.Items, elt)
+				continue
+			}
+			// Comments following the last entry of the inline table are
+			// kept as a free-standing comment block in the section.
+			tail := elt.Tail
+			elt.Tail = nil
+			sub.Items = append(sub.Items, elt, tail)
+		}
+		added = append(added, sub)
+		added = append(added, expandSection(sub, pred)...)
+	}
+	s.Items = keep
+	return added
+}
+
+// NormalizeDateTimeLiterals rewrites each date and time value in doc into a
+// canonical form based on RFC 3339: The date and time are separated by an
+// upper-case "T", a zero UTC offset is written as "Z", and fractional seconds
+// are written without trailing zeros. Local dates and times are written in the
+// same form, without the components they lack.
+//
+// All values are checked before reporting an error for any literals that are
+// not valid dates or times (for example, 2021-13-01); those are not changed.
+func NormalizeDateTimeLiterals() Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		var bad []string
+		walkValues(doc, func(v *parser.Value) {
+			tok, ok := v.X.(parser.Token)
+			if !ok {
+				return
+			}
+			layout, ok := parser.TimeLayout(tok.Type)
+			if !ok {
+				return
+			}
+			ts, err := tok.Time()
+			if err != nil {
+				bad = append(bad, tok.String())
+				return
+			}
+			nv, err := parser.ParseValue(ts.Format(layout))
+			if err != nil {
+				bad = append(bad, tok.String()) // should not happen
+				return
+			}
+			v.X = nv.X
+		})
+		if len(bad) != 0 {
+			return fmt.Errorf("invalid date/time literals: %q", bad)
+		}
+		return nil
+	}
+}
+
+// SetGeneratedBanner sets the leading comment block of doc to a banner
+// consisting of the given lines, which are cleaned as comments (see
+// parser.Comments). If withTimestamp is true, a line containing the current
+// UTC time in RFC 3339 format is appended to the banner.  This transformation
+// cannot fail.
+//
+// If the global section begins with a free-standing comment block whose first
+// line matches the first line of the banner, that block is taken to be a
+// banner from a previous run and is replaced. When lines is empty, so that the
+// banner consists only of a timestamp, a block consisting only of a timestamp
+// is replaced. Otherwise the banner is inserted at the beginning of the
+// document.
+func SetGeneratedBanner(lines []string, withTimestamp bool) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		base := parser.Comments(lines).Clean()
+		banner := base
+		if withTimestamp {
+			banner = append(banner, "# "+time.Now().UTC().Format(time.RFC3339))
+		}
+		if len(banner) == 0 {
+			return nil
+		}
+		if doc.Global == nil {
+			doc.Global = new(tomledit.Section)
+		}
+		items := doc.Global.Items
+		if len(items) != 0 {
+			if old, ok := items[0].(parser.Comments); ok && isBanner(old.Clean(), base, withTimestamp) {
+				items[0] = parser.Comments(banner)
+				return nil
+			}
+		}
+		doc.Global.Items = append([]parser.Item{parser.Comments(banner)}, items...)
+		return nil
+	}
+}
+
+// isBanner reports whether the cleaned comment lines in old are a banner
+// previously written by SetGeneratedBanner with the cleaned lines in base.
+// The timestamp line, if any, is not compared since it changes on each run.
+func isBanner(old, base []string, withTimestamp bool) bool {
+	if withTimestamp && len(old) != 0 {
+		last := strings.TrimPrefix(old[len(old)-1], "# ")
+		if _, err := time.Parse(time.RFC3339, last); err == nil {
+			old = old[:len(old)-1]
+			if len(base) == 0 {
+				return len(old) == 0
+			}
+		}
+	}
+	return len(base) != 0 && len(old) != 0 && old[0] == base[0]
+}
+
+// ZipToArrayTable converts a set of parallel arrays into elements of the
+// array table named by into. The arrays map gives the key of each source
+// array, indexed by the name of the field it populates. The i-th element of
+// the array table contains a mapping for each field, whose value is the i-th
+// value of the corresponding array, with fields in order by name.
+//
+// The new elements are added after the last existing element of the array
+// table, if any, or otherwise at the end of the document, and the source
+// arrays are removed. It reports an error without modifying doc if any source
+// key is missing or is not an array, or if the arrays do not all have the
+// same number of values.
+func ZipToArrayTable(arrays map[string]parser.Key, into parser.Key) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		fields := slices.Sorted(maps.Keys(arrays))
+		srcs := make([]*tomledit.Entry, len(fields))
+		vals := make([][]parser.Value, len(fields))
+		for i, field := range fields {
+			key := arrays[field]
+			e := doc.First(key...)
+			if e == nil || !e.IsMapping() {
+				return fmt.Errorf("no mapping found for key %q", key)
+			}
+			arr, ok := e.Value.X.(parser.Array)
+			if !ok {
+				return fmt.Errorf("value of %q is not an array", key)
+			}
+			for _, elt := range arr {
+				if v, ok := elt.(parser.Value); ok {
+					vals[i] = append(vals[i], v)
+				}
+			}
+			if len(vals[i]) != len(vals[0]) {
+				return fmt.Errorf("array %q has length %d, want %d", key, len(vals[i]), len(vals[0]))
+			}
+			srcs[i] = e
+		}
+
+		var elts []*tomledit.Section
+		for i := 0; len(vals) != 0 && i < len(vals[0]); i++ {
+			sec := &tomledit.Section{Heading: &parser.Heading{IsArray: true, Name: into}}
+			for j, field := range fields {
+				sec.Items = append(sec.Items, &parser.KeyValue{
+					Name:  parser.Key{field},
+					Value: parser.Value{X: vals[j][i].X, Trailer: vals[j][i].Trailer},
+				})
+			}
+			elts = append(elts, sec)
+		}
+		for _, e := range srcs {
+			e.Remove()
+		}
+
+		pos := len(doc.Sections)
+		for i, s := range doc.Sections {
+			if s.IsArray && s.TableName().Equals(into) {
+				pos = i + 1
+			}
+		}
+		doc.Sections = slices.Insert(doc.Sections, pos, elts...)
+		return nil
+	}
+}
+
+// EnsureComment ensures that the block comment attached to the section or
+// mapping at key consists of the given lines. If the existing block comment
+// is absent or differs from lines (after cleaning, see parser.Comments), it is
+// replaced; otherwise doc is not changed. It reports an error if key is not
+// found, or refers to a mapping inside an inline table, which cannot have a
+// block comment.
+func EnsureComment(key parser.Key, lines parser.Comments) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		e := doc.First(key...)
+		if e == nil {
+			return fmt.Errorf("key %q not found", key)
+		} else if e.IsInline() {
+			return fmt.Errorf("key %q is in an inline table", key)
+		}
+		var block *parser.Comments
+		if e.IsMapping() {
+			block = &e.KeyValue.Block
+		} else if !e.IsGlobal() {
+			block = &e.Heading.Block
+		} else {
+			return fmt.Errorf("key %q not found", key)
+		}
+		if !slices.Equal(block.Clean(), lines.Clean()) {
+			*block = lines
+		}
+		return nil
+	}
+}
+
+// SetComment sets the block comment and trailing comment of the section or
+// mapping at key. If block != nil, it replaces the existing block comment, so
+// that an empty non-nil block removes it. If trailer != "", it replaces the
+// existing trailing comment. The new comments are cleaned as by the formatter
+// (see parser.Comments and parser.CleanTrailer), so comment markers may be
+// omitted. It reports an error if key is not found, or refers to a mapping
+// inside an inline table, which cannot have comments.
+func SetComment(key parser.Key, block parser.Comments, trailer string) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		e := doc.First(key...)
+		if e == nil || (e.IsSection() && e.IsGlobal()) {
+			return fmt.Errorf("key %q not found", key)
+		} else if e.IsInline() {
+			return fmt.Errorf("key %q is in an inline table", key)
+		}
+		var pblock *parser.Comments
+		var ptrailer *string
+		if e.IsMapping() {
+			pblock, ptrailer = &e.KeyValue.Block, &e.KeyValue.Value.Trailer
+		} else {
+			pblock, ptrailer = &e.Heading.Block, &e.Heading.Trailer
+		}
+		if block != nil {
+			*pblock = parser.Comments(block.Clean())
+		}
+		if trailer != "" {
+			*ptrailer = parser.CleanTrailer(trailer)
+		}
+		return nil
+	}
+}
+
+// SectionsToArrayTable converts each table whose name is prefix.X for some
+// segment X into an element of the array table named by into, and adds a
+// mapping nameField = "X" at the beginning of the element. Any tables nested
+// inside prefix.X are renamed to follow the new element, so for example
+// [prefix.X.sub] becomes [into.sub], placed after the element for X.
+//
+// The new elements replace the original tables, in order of the first
+// occurrence of each X, at the position of the first table converted.  It
+// reports an error without modifying doc if any of the tables to be converted
+// is itself an array table, or already defines nameField.
+func SectionsToArrayTable(prefix parser.Key, nameField string, into parser.Key) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		var names []string                             // distinct values of X, in order
+		groups := make(map[string][]*tomledit.Section) // X → sections
+		pos := -1
+		var keep []*tomledit.Section
+		for _, s := range doc.Sections {
+			name := s.TableName()
+			if len(name) <= len(prefix) || !prefix.IsPrefixOf(name) {
+				keep = append(keep, s)
+				continue
+			}
+			x := name[len(prefix)]
+			if len(name) == len(prefix)+1 {
+				if s.IsArray {
+					return fmt.Errorf("table %q is an array table", name)
+				}
+				for _, item := range s.Items {
+					if kv, ok := item.(*parser.KeyValue); ok && kv.Name.Equals(parser.Key{nameField}) {
+						return fmt.Errorf("table %q already defines %q", name, nameField)
+					}
+				}
+			}
+			if _, ok := groups[x]; !ok {
+				names = append(names, x)
+			}
+			groups[x] = append(groups[x], s)
+			if pos < 0 {
+				pos = len(keep)
+			}
+		}
+		if pos < 0 {
+			return nil // nothing to do
+		}
+
+		var elts []*tomledit.Section
+		for _, x := range names {
+			field := &parser.KeyValue{
+				Name:  parser.Key{nameField},
+				Value: parser.MustValue(`"` + string(scanner.Escape(x)) + `"`),
+			}
+			head := &tomledit.Section{Heading: &parser.Heading{}}
+			var subs []*tomledit.Section
+			for _, s := range groups[x] {
+				if len(s.Name) == len(prefix)+1 {
+					head = s
+				} else {
+					s.Heading.Name = append(append(parser.Key(nil), into...), s.Name[len(prefix)+1:]...)
+					subs = append(subs, s)
+				}
+			}
+			head.Heading.IsArray = true
+			head.Heading.Name = into
+			head.Items = append([]parser.Item{field}, head.Items...)
+			elts = append(append(elts, head), subs...)
+		}
+		doc.Sections = slices.Insert(keep, pos, elts...)
+		return nil
+	}
+}
+
+// CheckTableArrayConflicts reports an error if any name in doc is used both
+// for a table ([x]) and for an array table ([[x]]), which TOML forbids but the
+// parser does not check. The error describes each conflicting name with the
+// lines of its first definition as a table and as an array table.  This
+// transformation does not modify doc.
+func CheckTableArrayConflicts() Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		type defs struct {
+			name         parser.Key
+			table, array *parser.Heading
+		}
+		var all []*defs
+		find := func(name parser.Key) *defs {
+			for _, d := range all {
+				if d.name.Equals(name) {
+					return d
+				}
+			}
+			d := &defs{name: name}
+			all = append(all, d)
+			return d
+		}
+		for _, s := range doc.Sections {
+			if s.Heading == nil {
+				continue
+			}
+			d := find(s.Name)
+			if s.IsArray && d.array == nil {
+				d.array = s.Heading
+			} else if !s.IsArray && d.table == nil {
+				d.table = s.Heading
+			}
+		}
+		var msgs []string
+		for _, d := range all {
+			if d.table != nil && d.array != nil {
+				msgs = append(msgs, fmt.Sprintf("%q is a table at line %d and an array table at line %d",
+					d.name.String(), d.table.Line, d.array.Line))
+			}
+		}
+		if len(msgs) != 0 {
+			return fmt.Errorf("conflicting table definitions: %s", strings.Join(msgs, "; "))
+		}
+		return nil
+	}
+}
+
+// MultilineForm selects the form of multi-line strings for
+// NormalizeMultilineStrings.
+type MultilineForm int
+
+// Constants defining the supported multi-line string forms.
+const (
+	KeepForm    MultilineForm = iota // leave the form unchanged
+	BasicForm                        // use basic strings ("""...""")
+	LiteralForm                      // use literal strings ('''...''') where possible
+)
+
+// MultilineOptions are options for NormalizeMultilineStrings.
+type MultilineOptions struct {
+	// If true, ensure each multi-line string begins with a newline after its
+	// opening delimiter. TOML discards such a newline, so adding one does not
+	// change the content of the string.
+	LeadingNewline bool
+
+	// If true, replace CRLF line breaks with LF within multi-line strings.
+	// TOML permits a parser to normalize line breaks in multi-line strings, so
+	// this does not change the meaning of the string.
+	NormalizeNewlines bool
+
+	// Selects the form of multi-line strings. A basic string can be converted
+	// to a literal string only if its content has no control characters other
+	// than tab and newline, does not contain "'''", and does not end with "'".
+	// Converting a basic string discards any line-ending backslashes.
+	Form MultilineForm
+}
+
+// NormalizeMultilineStrings rewrites the multi-line string values in doc to a
+// consistent style, as specified by opts. It does not change the content of
+// the strings. This transformation cannot fail.
+func NormalizeMultilineStrings(opts MultilineOptions) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		walkValues(doc, func(v *parser.Value) {
+			t, ok := v.X.(parser.Token)
+			if !ok || (t.Type != scanner.MString && t.Type != scanner.MLString) {
+				return
+			}
+			text := t.String()
+			quote, body := text[:3], text[3:len(text)-3]
+			if opts.NormalizeNewlines {
+				body = strings.ReplaceAll(body, "\r\n", "\n")
+			}
+
+			wantLiteral := t.Type == scanner.MLString
+			if opts.Form == BasicForm {
+				wantLiteral = false
+			} else if opts.Form == LiteralForm {
+				wantLiteral = true
+			}
+			if wantLiteral != (t.Type == scanner.MLString) {
+				if q, b, ok := convertMultiline(t, wantLiteral, opts.NormalizeNewlines); ok {
+					quote, body = q, b
+				}
+			}
+			if opts.LeadingNewline && !strings.HasPrefix(body, "\n") && !strings.HasPrefix(body, "\r\n") {
+				body = "\n" + body
+			}
+			if fixed := quote + body + quote; fixed != text {
+				v.X = parser.MustValue(fixed).X
+			}
+		})
+		return nil
+	}
+}
+
+// convertMultiline returns the delimiter and body of a multi-line string with
+// the same content as t, in literal form if literal is true, or otherwise in
+// basic form. If newlines is true, CRLF line breaks in the content are
+// replaced by LF. It reports false if the content of t cannot be represented
+// in the requested form.
+func convertMultiline(t parser.Token, literal, newlines bool) (quote, body string, ok bool) {
+	content, err := t.Unquote()
+	if err != nil {
+		return "", "", false
+	}
+	if newlines {
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+	}
+	if literal {
+		if !canBeLiteral(content) {
+			return "", "", false
+		}
+		quote, body = "'''", content
+	} else {
+		quote, body = `"""`, string(scanner.EscapeMultiline(content))
+	}
+	// Preserve a leading newline in the content, since a newline just after
+	// the opening delimiter is discarded.
+	if strings.HasPrefix(body, "\n") {
+		body = "\n" + body
+	}
+	return quote, body, true
+}
+
+// canBeLiteral reports whether s can be the content of a multi-line literal
+// string.
+func canBeLiteral(s string) bool {
+	if strings.Contains(s, "'''") || strings.HasSuffix(s, "'") {
+		return false
+	}
+	for _, r := range s {
+		if (r < ' ' && r != '\t' && r != '\n') || r == '\x7f' {
+			return false
+		}
+	}
+	return true
+}
+
+// GroupArrayTables moves all the elements of the array table with the given
+// name into a contiguous run, at the position of the first element. Each
+// element is moved together with the tables nested inside it, that is the
+// sections immediately following it whose names extend name, since these
+// belong to that element.  The relative order of the elements and of the
+// other sections of doc is preserved. This transformation cannot fail.
+func GroupArrayTables(name parser.Key) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		var keep, group []*tomledit.Section
+		pos := -1
+		inElement := false
+		for _, s := range doc.Sections {
+			sname := s.TableName()
+			if s.IsArray && sname.Equals(name) {
+				inElement = true
+				if pos < 0 {
+					pos = len(keep)
+				}
+			} else if !inElement || len(sname) <= len(name) || !name.IsPrefixOf(sname) {
+				inElement = false
+				keep = append(keep, s)
+				continue
+			}
+			group = append(group, s)
+		}
+		if pos >= 0 {
+			doc.Sections = slices.Insert(keep, pos, group...)
+		}
+		return nil
+	}
+}
+
+// refPattern matches interpolation references of the form ${name}.
+var refPattern = regexp.MustCompile(`\$\{([^{}]*)\}`)
+
+// CheckReferences reports an error if any string value in doc contains an
+// interpolation reference of the form ${name} for which resolve returns false.
+// If resolve == nil, a reference resolves if name is a valid key (see
+// parser.ParseKey) that denotes a section or mapping in doc. The error lists
+// each unresolved reference together with the key of the value containing it.
+// This transformation does not modify doc.
+func CheckReferences(resolve func(name string) bool) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		ok := resolve
+		if ok == nil {
+			ok = func(name string) bool {
+				key, err := parser.ParseKey(name)
+				return err == nil && doc.First(key...) != nil
+			}
+		}
+		var bad []string
+		for _, ref := range doc.Strings() {
+			for _, m := range refPattern.FindAllStringSubmatch(ref.Value, -1) {
+				if !ok(m[1]) {
+					bad = append(bad, fmt.Sprintf("%s (in %s)", m[0], ref.Key))
+				}
+			}
+		}
+		if len(bad) != 0 {
+			return fmt.Errorf("unresolved references: %s", strings.Join(bad, ", "))
+		}
+		return nil
+	}
+}
+
+// envPattern matches environment variable references of the form ${NAME} or
+// $NAME.
+var envPattern = regexp.MustCompile(`\$\{([^{}]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// ExpandEnv replaces references of the form ${NAME} or $NAME in the string
+// values of doc with the values of the corresponding variables, as reported by
+// lookup; os.LookupEnv is a suitable implementation. Strings inside arrays and
+// inline tables are also expanded, and other values are not changed. A string
+// that is changed becomes a basic string, or a multi-line basic string if it
+// was multi-line. References to variables that lookup does not define are
+// left unchanged. This transformation cannot fail.
+func ExpandEnv(lookup func(string) (string, bool)) Func { return expandEnv(lookup, false) }
+
+// ExpandEnvStrict behaves as ExpandEnv, but reports an error listing any
+// references to variables that lookup does not define.  All the strings in
+// doc are expanded before reporting an error.
+func ExpandEnvStrict(lookup func(string) (string, bool)) Func { return expandEnv(lookup, true) }
+
+func expandEnv(lookup func(string) (string, bool), strict bool) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		var bad []string
+		for _, ref := range doc.Strings() {
+			out := envPattern.ReplaceAllStringFunc(ref.Value, func(m string) string {
+				sub := envPattern.FindStringSubmatch(m)
+				name := sub[1] + sub[2] // exactly one is non-empty
+				if val, ok := lookup(name); ok {
+					return val
+				}
+				bad = append(bad, fmt.Sprintf("%s (in %s)", m, ref.Key))
+				return m
+			})
+			if out != ref.Value {
+				ref.Set(out)
+			}
+		}
+		if strict && len(bad) != 0 {
+			return fmt.Errorf("undefined variables: %s", strings.Join(bad, ", "))
+		}
+		return nil
+	}
+}
+
+// AlignArrayRecords reorders the entries of each inline table in the array at
+// key, so that entries named by order come first in that order, followed by
+// any other entries in their original relative order. No entries are added or
+// removed, and elements of the array that are not inline tables are not
+// changed. It reports an error if key is not found or its value is not an
+// array.
+func AlignArrayRecords(key parser.Key, order []string) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		e := doc.First(key...)
+		if e == nil || !e.IsMapping() {
+			return fmt.Errorf("no mapping found for key %q", key)
+		}
+		arr, ok := e.Value.X.(parser.Array)
+		if !ok {
+			return fmt.Errorf("value of %q is not an array", key)
+		}
+		rank := func(kv *parser.KeyValue) int {
+			for i, name := range order {
+				if kv.Name.Equals(parser.Key{name}) {
+					return i
+				}
+			}
+			return len(order)
+		}
+		for _, elt := range arr {
+			if v, ok := elt.(parser.Value); ok {
+				if in, ok := v.X.(parser.Inline); ok {
+					slices.SortStableFunc(in, func(a, b *parser.KeyValue) int {
+						return rank(a) - rank(b)
+					})
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// SortArray performs a stable sort of the values in the array at key, using
+// less to compare values. If less == nil, ValueLess is used.  As with
+// SortKeyValuesByName, comments inside the array are left in their original
+// positions, but the trailing comment of each value moves with it. It reports
+// an error if key is not found or its value is not an array.
+func SortArray(key parser.Key, less func(a, b parser.Value) bool) Func {
+	if less == nil {
+		less = ValueLess
+	}
+	return func(_ context.Context, doc *tomledit.Document) error {
+		e := doc.First(key...)
+		if e == nil || !e.IsMapping() {
+			return fmt.Errorf("no mapping found for key %q", key)
+		}
+		arr, ok := e.Value.X.(parser.Array)
+		if !ok {
+			return fmt.Errorf("value of %q is not an array", key)
+		}
+		var pos []int
+		for i, elt := range arr {
+			if _, ok := elt.(parser.Value); ok {
+				pos = append(pos, i)
+			}
+		}
+		vals := arr.Values()
+		slices.SortStableFunc(vals, func(a, b parser.Value) int {
+			if less(a, b) {
+				return -1
+			} else if less(b, a) {
+				return 1
+			}
+			return 0
+		})
+		for i, p := range pos {
+			arr[p] = vals[i]
+		}
+		return nil
+	}
+}
+
+// DedupePolicy is the policy for DedupeKeys.
+type DedupePolicy struct {
+	// If true, keep the last occurrence of a duplicated key. By default, the
+	// first occurrence is kept.
+	KeepLast bool
+
+	// If true, merge the contents of table sections that have the same name
+	// into a single section, at the position of the occurrence chosen by
+	// KeepLast. By default, duplicate table sections are reported as an error.
+	// Array tables are never merged.
+	MergeSections bool
+
+	// If set, Removed is called with the full key of each mapping removed, and
+	// the name of each table section merged into another.
+	Removed func(key parser.Key)
+}
+
+// DedupeKeys removes mappings whose keys duplicate another mapping in the same
+// table section, keeping one occurrence as selected by policy. The comments of
+// a removed mapping are removed along with it. Duplicate table sections are
+// merged before removing duplicate keys, if policy.MergeSections is true.
+//
+// It reports an error if doc contains duplicate table sections and
+// policy.MergeSections is false; in that case duplicate keys are still
+// removed within each section.
+func DedupeKeys(policy DedupePolicy) Func {
+	removed := func(key parser.Key) {
+		if policy.Removed != nil {
+			policy.Removed(key)
+		}
+	}
+	return func(_ context.Context, doc *tomledit.Document) error {
+		var dups []string
+		seen := make(map[string]*tomledit.Section)
+		arrays := make(map[string]int) // number of elements of each array table
+		var keep []*tomledit.Section
+		for _, s := range doc.Sections {
+			if s.IsArray {
+				arrays[s.TableName().String()]++
+				keep = append(keep, s)
+				continue
+			}
+			name := elementPath(s.TableName(), arrays)
+			old, ok := seen[name]
+			if !ok {
+				seen[name] = s
+				keep = append(keep, s)
+				continue
+			} else if !policy.MergeSections {
+				dups = append(dups, s.TableName().String())
+				keep = append(keep, s)
+				continue
+			}
+			removed(s.TableName())
+			if policy.KeepLast {
+				s.Items = append(old.Items, s.Items...)
+				i := slices.Index(keep, old)
+				keep = append(slices.Delete(keep, i, i+1), s)
+				seen[name] = s
+			} else {
+				old.Items = append(old.Items, s.Items...)
+			}
+		}
+		doc.Sections = keep
+
+		dedupe := func(s *tomledit.Section) {
+			if s == nil {
+				return
+			}
+			win := make(map[string]*parser.KeyValue)
+			for _, item := range s.Items {
+				if kv, ok := item.(*parser.KeyValue); ok {
+					key := kv.Name.String()
+					if _, ok := win[key]; !ok || policy.KeepLast {
+						win[key] = kv
+					}
+				}
+			}
+			s.Items = slices.DeleteFunc(s.Items, func(item parser.Item) bool {
+				kv, ok := item.(*parser.KeyValue)
+				if !ok || win[kv.Name.String()] == kv {
+					return false
+				}
+				removed(append(append(parser.Key(nil), s.TableName()...), kv.Name...))
+				return true
+			})
+		}
+		dedupe(doc.Global)
+		for _, s := range doc.Sections {
+			dedupe(s)
+		}
+		if len(dups) != 0 {
+			return fmt.Errorf("duplicate table sections: %q", dups)
+		}
+		return nil
+	}
+}
+
+// elementPath returns a string identifying the table named by key, in which
+// each prefix of key that names an array table is qualified by the number of
+// elements of that array seen so far, as recorded in arrays. Thus tables with
+// the same name in different elements of an array table have different paths.
+func elementPath(key parser.Key, arrays map[string]int) string {
+	var sb strings.Builder
+	for i, seg := range key {
+		if i > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(strconv.Quote(seg))
+		if n, ok := arrays[key[:i+1].String()]; ok {
+			fmt.Fprintf(&sb, "#%d", n)
+		}
+	}
+	return sb.String()
+}
+
+// ForEachTable calls fn for each table section of doc whose name equals name,
+// in order of occurrence. For an array table, this includes every element of
+// the array. If fn reports an error, ForEachTable stops and returns that error
+// annotated with the table name and the offset of the section among those
+// matched. It is not an error if no section matches name.
+func ForEachTable(name parser.Key, fn func(*tomledit.Section) error) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		for i, s := range doc.FindSections(name) {
+			if err := fn(s); err != nil {
+				return fmt.Errorf("table %q (%d): %w", name, i, err)
+			}
+		}
+		return nil
+	}
+}
+
+// OrderKeys reorders the mappings of the first table section with the given
+// name, so that the mappings whose keys are listed in order come first, in
+// the order given, followed by the remaining mappings in their original
+// relative order. An empty section name denotes the global table. Keys are
+// relative to the section, and keys listed in order that are not defined in
+// the section are ignored.
+//
+// A free-standing comment block immediately before a mapping moves along with
+// that mapping, while comment blocks at the end of the section remain there.
+// It reports an error if the section is not found.
+func OrderKeys(section parser.Key, order []parser.Key) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		tab := FindTable(doc, section...)
+		if tab == nil {
+			return fmt.Errorf("table %q not found", section)
+		}
+		rank := func(kv *parser.KeyValue) int {
+			if i := slices.IndexFunc(order, kv.Name.Equals); i >= 0 {
+				return i
+			}
+			return len(order)
+		}
+
+		// Group each mapping with the comment blocks that precede it.
+		type unit struct {
+			items []parser.Item
+			rank  int
+		}
+		var units []unit
+		var cur []parser.Item
+		for _, item := range tab.Items {
+			cur = append(cur, item)
+			if kv, ok := item.(*parser.KeyValue); ok {
+				units = append(units, unit{items: cur, rank: rank(kv)})
+				cur = nil
+			}
+		}
+		slices.SortStableFunc(units, func(a, b unit) int { return a.rank - b.rank })
+
+		items := make([]parser.Item, 0, len(tab.Items))
+		for _, u := range units {
+			items = append(items, u.items...)
+		}
+		tab.Items = append(items, cur...)
+		return nil
+	}
+}
+
+// MoveSection moves the first table section with the given name so that it
+// immediately precedes the first section named before, or to the end of the
+// document if before is empty. The section is moved along with its comments,
+// but tables nested inside it are not moved. Moving a section before itself
+// has no effect. It reports an error if either section is not found.
+func MoveSection(name, before parser.Key) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		named := func(key parser.Key) func(*tomledit.Section) bool {
+			return func(s *tomledit.Section) bool { return s.TableName().Equals(key) }
+		}
+		i := slices.IndexFunc(doc.Sections, named(name))
+		if i < 0 {
+			return fmt.Errorf("table %q not found", name)
+		}
+		j := len(doc.Sections)
+		if len(before) != 0 {
+			j = slices.IndexFunc(doc.Sections, named(before))
+			if j < 0 {
+				return fmt.Errorf("table %q not found", before)
+			} else if j == i {
+				return nil
+			}
+		}
+		s := doc.Sections[i]
+		doc.Sections = slices.Delete(doc.Sections, i, i+1)
+		if j > i {
+			j--
+		}
+		doc.Sections = slices.Insert(doc.Sections, j, s)
+		return nil
+	}
+}
@@ -3,10 +3,14 @@
 package transform
 
 import (
+	"fmt"
+	"math"
+	"slices"
 	"sort"
 
 	"github.com/creachadair/tomledit"
 	"github.com/creachadair/tomledit/parser"
+	"github.com/creachadair/tomledit/scanner"
 )
 
 // FindTable returns the entry the first table with the given name in doc, or
@@ -57,19 +61,66 @@ func InsertMapping(tab *tomledit.Section, kv *parser.KeyValue, replace bool) boo
 	return true
 }
 
+// InsertMappingAt inserts kv into tab at the given index among its items, so
+// that 0 inserts kv before all other items and len(tab.Items) inserts it after
+// all other items. Unlike InsertMapping, the index counts comment blocks as
+// items, and kv is not moved before comments at the end of the section. It
+// reports an error if index is out of range, or if tab already contains a
+// mapping with the same name as kv.
+func InsertMappingAt(tab *tomledit.Section, index int, kv *parser.KeyValue) error {
+	if index < 0 || index > len(tab.Items) {
+		return fmt.Errorf("index %d out of range [0..%d]", index, len(tab.Items))
+	}
+	for _, item := range tab.Items {
+		if cur, ok := item.(*parser.KeyValue); ok && cur.Name.Equals(kv.Name) {
+			return fmt.Errorf("key %q already exists", kv.Name)
+		}
+	}
+	tab.Items = slices.Insert(tab.Items, index, parser.Item(kv))
+	return nil
+}
+
+// UpsertMapping sets the value of the mapping in tab with the same name as kv
+// to the value of kv, or inserts kv as by InsertMapping if tab has no such
+// mapping. When updating an existing mapping, its block comment and position
+// are retained, and its trailing comment is replaced only if kv has one. The
+// function reports true if kv was inserted as a new mapping, otherwise false.
+func UpsertMapping(tab *tomledit.Section, kv *parser.KeyValue) bool {
+	for _, item := range tab.Items {
+		if cur, ok := item.(*parser.KeyValue); ok && cur.Name.Equals(kv.Name) {
+			trailer := cur.Value.Trailer
+			cur.Value = kv.Value
+			if cur.Value.Trailer == "" {
+				cur.Value.Trailer = trailer
+			}
+			return false
+		}
+	}
+	return InsertMapping(tab, kv, false)
+}
+
 // SortSectionsByName performs a stable in-place sort of the given slice of
 // sections by their name.
-func SortSectionsByName(ss []*tomledit.Section) {
+func SortSectionsByName(ss []*tomledit.Section) { SortSectionsByNameFunc(ss, parser.Key.Before) }
+
+// SortSectionsByNameFunc performs a stable in-place sort of the given slice of
+// sections by their name, using less to compare names. For example, to sort
+// numbered names in natural order, pass parser.Key.BeforeNatural.
+func SortSectionsByNameFunc(ss []*tomledit.Section, less func(a, b parser.Key) bool) {
 	sort.SliceStable(ss, func(i, j int) bool {
-		return ss[i].TableName().Before(ss[j].TableName())
+		return less(ss[i].TableName(), ss[j].TableName())
 	})
 }
 
 // SortKeyValuesByName performs a stable in-place sort of items, so that any
 // key-value entries are ordered by their names, but other items such as
 // comments are left in their original positions.
-func SortKeyValuesByName(items []parser.Item) {
-	s := subseq{orig: items}
+func SortKeyValuesByName(items []parser.Item) { SortKeyValuesByNameFunc(items, parser.Key.Before) }
+
+// SortKeyValuesByNameFunc is as SortKeyValuesByName, but uses less to compare
+// the names of key-value entries.
+func SortKeyValuesByNameFunc(items []parser.Item, less func(a, b parser.Key) bool) {
+	s := subseq{orig: items, less: less}
 	for i, item := range items {
 		kv, ok := item.(*parser.KeyValue)
 		if ok {
@@ -81,6 +132,52 @@ func SortKeyValuesByName(items []parser.Item) {
 	sort.Stable(s)
 }
 
+// ValueLess reports whether a is ordered before b. Integers and floats are
+// ordered numerically, and strings are ordered by their contents regardless
+// of quoting, with numbers before strings. Other values, and values that
+// cannot be decoded, are ordered by their text after numbers and strings.
+func ValueLess(a, b parser.Value) bool {
+	// Compare integers exactly, since not all int64 values are representable
+	// as float64.
+	if ai, err := a.Int(); err == nil {
+		if bi, err := b.Int(); err == nil {
+			return ai < bi
+		}
+	}
+	ak, an, as := valueSortKey(a)
+	bk, bn, bs := valueSortKey(b)
+	if ak != bk {
+		return ak < bk
+	} else if ak == 0 {
+		return an < bn
+	}
+	return as < bs
+}
+
+// valueSortKey returns the sort class of v for ValueLess, along with its
+// numeric value (class 0) or its text (classes 1 and 2).
+func valueSortKey(v parser.Value) (int, float64, string) {
+	tok, ok := v.X.(parser.Token)
+	if !ok {
+		return 2, 0, v.String()
+	}
+	switch tok.Type {
+	case scanner.Integer:
+		if n, err := tok.Int(); err == nil {
+			return 0, float64(n), ""
+		}
+	case scanner.Float:
+		if f, err := tok.Float(); err == nil && !math.IsNaN(f) {
+			return 0, f, ""
+		}
+	default:
+		if s, err := tok.Unquote(); err == nil {
+			return 1, 0, s
+		}
+	}
+	return 2, 0, tok.String()
+}
+
 // subseq implements sort.Interface to sort a subsequence of the elements of
 // the original slice.
 //
@@ -96,10 +193,12 @@ type subseq struct {
 	orig []parser.Item // the original input slice
 	pos  []int         // pos[i] is the offset in orig of the ith subsequence item
 	name []parser.Key  // the key of the current ith subsequence item
+
+	less func(a, b parser.Key) bool // the ordering of keys
 }
 
 func (s subseq) Len() int           { return len(s.pos) }
-func (s subseq) Less(i, j int) bool { return s.name[i].Before(s.name[j]) }
+func (s subseq) Less(i, j int) bool { return s.less(s.name[i], s.name[j]) }
 
 func (s subseq) Swap(i, j int) {
 	// N.B. we do not permute s.pos, because the offsets in the original
@@ -109,3 +208,42 @@ func (s subseq) Swap(i, j int) {
 	s.orig[oi], s.orig[oj] = s.orig[oj], s.orig[oi]
 	s.name[i], s.name[j] = s.name[j], s.name[i]
 }
+
+// walkValues calls f with a pointer to each value bound in doc, including the
+// elements of arrays and the members of inline tables, in order of occurrence.
+// A compound value is visited before its contents, so f may replace it.
+func walkValues(doc *tomledit.Document, f func(*parser.Value)) {
+	for _, s := range allSections(doc) {
+		for _, item := range s.Items {
+			if kv, ok := item.(*parser.KeyValue); ok {
+				walkValue(&kv.Value, f)
+			}
+		}
+	}
+}
+
+func walkValue(v *parser.Value, f func(*parser.Value)) {
+	f(v)
+	switch t := v.X.(type) {
+	case parser.Array:
+		for i, elt := range t {
+			if ev, ok := elt.(parser.Value); ok {
+				walkValue(&ev, f)
+				t[i] = ev
+			}
+		}
+	case parser.Inline:
+		for _, kv := range t {
+			walkValue(&kv.Value, f)
+		}
+	}
+}
+
+// allSections returns a slice of all the sections of doc, including the global
+// section if it is present.
+func allSections(doc *tomledit.Document) []*tomledit.Section {
+	if doc.Global == nil {
+		return doc.Sections
+	}
+	return append([]*tomledit.Section{doc.Global}, doc.Sections...)
+}
@@ -0,0 +1,257 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package transform
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/creachadair/tomledit"
+	"github.com/creachadair/tomledit/parser"
+	"github.com/creachadair/tomledit/scanner"
+)
+
+// KeyStyle is a naming convention for the words of a key segment.
+type KeyStyle int
+
+// Constants defining the supported key styles.
+const (
+	SnakeCase KeyStyle = iota // words separated by underscores (max_conn_count)
+	KebabCase                 // words separated by hyphens (max-conn-count)
+	CamelCase                 // words run together with capitals (maxConnCount)
+	LowerCase                 // letters lowercased, separators unchanged
+)
+
+// NormalizeKeyStyle converts the names of all sections and mappings in doc to
+// the specified style. If except != nil, it is called with the complete key of
+// each section or mapping before any changes are made; if it returns true,
+// the name of that entry is left unchanged. This transformation cannot fail.
+//
+// Each segment of a key is split into words at underscores, hyphens, and at
+// changes of case, so that "maxConn", "max_conn", "max-conn", and "MaxConn"
+// all consist of the words "max" and "conn". A run of capitals is treated as
+// a single word, so "HTTPServer" consists of "http" and "server".
+//
+// Key segments that are not valid bare words (for example, those containing
+// spaces or dots) are not modified.
+func NormalizeKeyStyle(style KeyStyle, except func(parser.Key) bool) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		type match struct {
+			key parser.Key
+			e   *tomledit.Entry
+		}
+		var all []match
+		doc.Scan(func(key parser.Key, e *tomledit.Entry) bool {
+			all = append(all, match{append(parser.Key(nil), key...), e})
+			return true
+		})
+		for _, m := range all {
+			if except != nil && except(m.key) {
+				continue
+			}
+			if m.e.IsSection() && !m.e.IsGlobal() {
+				m.e.Heading.Name = styleKey(m.e.TableName(), style)
+			} else if m.e.IsMapping() {
+				m.e.KeyValue.Name = styleKey(m.e.KeyValue.Name, style)
+			}
+		}
+		return nil
+	}
+}
+
+func styleKey(key parser.Key, style KeyStyle) parser.Key {
+	out := make(parser.Key, len(key))
+	for i, seg := range key {
+		out[i] = styleWord(seg, style)
+	}
+	return out
+}
+
+func styleWord(seg string, style KeyStyle) string {
+	if !scanner.IsWord(seg) {
+		return seg
+	} else if style == LowerCase {
+		return strings.ToLower(seg)
+	}
+	words := splitWords(seg)
+	switch style {
+	case SnakeCase:
+		return strings.Join(words, "_")
+	case KebabCase:
+		return strings.Join(words, "-")
+	case CamelCase:
+		for i := 1; i < len(words); i++ {
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		}
+		return strings.Join(words, "")
+	}
+	return seg
+}
+
+// splitWords splits a bare word into lowercase words at separators and case
+// changes. If seg contains no letters or digits, it is returned unchanged.
+func splitWords(seg string) []string {
+	rs := []rune(seg)
+	var words []string
+	var cur []rune
+	push := func() {
+		if len(cur) != 0 {
+			words = append(words, strings.ToLower(string(cur)))
+			cur = nil
+		}
+	}
+	for i, r := range rs {
+		if r == '_' || r == '-' {
+			push()
+			continue
+		}
+		if unicode.IsUpper(r) && i > 0 {
+			prev := rs[i-1]
+			// Break before an upper-case letter that follows a lower-case letter
+			// or digit ("maxConn"), or that ends a run of capitals and begins a
+			// new word ("HTTPServer").
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) {
+				push()
+			} else if unicode.IsUpper(prev) && i+1 < len(rs) && unicode.IsLower(rs[i+1]) {
+				push()
+			}
+		}
+		cur = append(cur, r)
+	}
+	push()
+	if len(words) == 0 {
+		return []string{seg}
+	}
+	return words
+}
+
+// RenameKeysRegexp renames the sections and mappings of doc by replacing
+// matches of re in each segment of their names with repl, which may contain
+// references to submatches like "$1" (see regexp.Regexp.Expand). Segments
+// with no matches are not changed. This transformation cannot fail.
+//
+// For example, to remove an "x_" prefix from all key segments:
+//
+//	transform.RenameKeysRegexp(regexp.MustCompile(`^x_(.*)$`), "$1")
+func RenameKeysRegexp(re *regexp.Regexp, repl string) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		doc.Scan(func(_ parser.Key, e *tomledit.Entry) bool {
+			name := entryName(e)
+			if name == nil {
+				return true
+			}
+			key := make(parser.Key, len(name))
+			for i, seg := range name {
+				key[i] = re.ReplaceAllString(seg, repl)
+			}
+			if e.IsSection() {
+				e.Heading.Name = key
+			} else {
+				e.KeyValue.Name = key
+			}
+			return true
+		})
+		return nil
+	}
+}
+
+// RenameFullKeysRegexp renames the sections and mappings of doc by replacing
+// matches of re in the string representation of their names (for example
+// a.b."c d") with repl, and parsing the result as a key.  Only the name of the
+// section or mapping itself is matched, not the name of its enclosing table.
+// All renames are attempted before reporting an error for any results that
+// are not valid keys; those entries are not changed.
+func RenameFullKeysRegexp(re *regexp.Regexp, repl string) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		var bad []string
+		doc.Scan(func(_ parser.Key, e *tomledit.Entry) bool {
+			name := entryName(e)
+			if name == nil {
+				return true
+			}
+			old := name.String()
+			if rep := re.ReplaceAllString(old, repl); rep != old {
+				key, err := parser.ParseKey(rep)
+				if err != nil {
+					bad = append(bad, rep)
+				} else if e.IsSection() {
+					e.Heading.Name = key
+				} else {
+					e.KeyValue.Name = key
+				}
+			}
+			return true
+		})
+		if len(bad) != 0 {
+			return fmt.Errorf("invalid keys: %q", bad)
+		}
+		return nil
+	}
+}
+
+// entryName returns the name of the section or mapping denoted by e, or nil if
+// e is the global section.
+func entryName(e *tomledit.Entry) parser.Key {
+	if e.IsMapping() {
+		return e.KeyValue.Name
+	} else if !e.IsGlobal() {
+		return e.Heading.Name
+	}
+	return nil
+}
+
+// SimplifyKeyQuoting removes redundant quotation marks from the names of the
+// sections and mappings in doc. This transformation cannot fail.
+//
+// A key segment never needs to include quotes to be formatted correctly, since
+// segments that are not valid bare words are quoted when the key is formatted.
+// However, a key constructed by a program may contain a segment that includes
+// quotation marks as part of its text, such as Key{`"simple"`}, which formats
+// as "\"simple\"". SimplifyKeyQuoting replaces each segment enclosed in
+// matching single or double quotes by its unquoted (and for double quotes,
+// unescaped) content.  Segments whose content is not a valid bare word, such
+// as those containing dots or spaces, or empty segments, remain quoted when
+// formatted.
+func SimplifyKeyQuoting() Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		doc.Scan(func(_ parser.Key, e *tomledit.Entry) bool {
+			name := entryName(e)
+			if name == nil {
+				return true
+			}
+			key := make(parser.Key, len(name))
+			for i, seg := range name {
+				key[i] = unquoteSegment(seg)
+			}
+			if e.IsSection() {
+				e.Heading.Name = key
+			} else {
+				e.KeyValue.Name = key
+			}
+			return true
+		})
+		return nil
+	}
+}
+
+// unquoteSegment returns the content of seg if it is enclosed in matching
+// quotes, or otherwise returns seg unchanged.
+func unquoteSegment(seg string) string {
+	if len(seg) < 2 || seg[0] != seg[len(seg)-1] {
+		return seg
+	}
+	switch seg[0] {
+	case '\'':
+		if inner := seg[1 : len(seg)-1]; !strings.Contains(inner, "'") {
+			return inner
+		}
+	case '"':
+		if dec, err := scanner.Unescape([]byte(seg[1 : len(seg)-1])); err == nil {
+			return string(dec)
+		}
+	}
+	return seg
+}
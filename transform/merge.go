@@ -0,0 +1,191 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package transform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/creachadair/tomledit"
+	"github.com/creachadair/tomledit/parser"
+)
+
+// MergeOptions are options for Merge. A nil *MergeOptions provides defaults.
+type MergeOptions struct {
+	// If true, the elements of an array value in the overlay are appended to
+	// the existing array value for the same key. By default, the array in the
+	// overlay replaces the existing array. This also applies to arrays of
+	// tables: by default, the elements of an array table in the overlay
+	// replace all the existing elements of that array table.
+	AppendArrays bool
+
+	// If true, the comments of a mapping in the overlay replace the comments
+	// of the existing mapping it updates. By default, the existing comments
+	// are kept. New mappings and tables always retain their comments.
+	OverlayComments bool
+}
+
+// Merge updates doc with the contents of overlay. Each mapping in overlay
+// replaces the value of the mapping with the same full key in doc, which is
+// updated in place. Mappings and tables in overlay that do not exist in doc
+// are added, to the end of the table that contains them or to the end of the
+// document, respectively. A value that is an inline table replaces the
+// existing value as a whole.
+//
+// After merging, doc may share values with overlay, so overlay should not be
+// modified or merged into another document.
+//
+// All the contents of overlay are attempted before reporting an error for any
+// keys that could not be merged because they conflict with the structure of
+// doc, for example a mapping in overlay whose key names a table in doc.
+func Merge(overlay *tomledit.Document, opts *MergeOptions) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		m := merger{doc: doc, replaced: make(map[string]bool)}
+		if opts != nil {
+			m.MergeOptions = *opts
+		}
+		m.mergeSection(overlay.Global)
+		for i := 0; i < len(overlay.Sections); i++ {
+			s := overlay.Sections[i]
+			if !s.IsArray {
+				m.mergeSection(s)
+				continue
+			}
+
+			// An element of an array table is added together with the tables
+			// nested inside it, which follow it in the overlay.
+			j := i + 1
+			for j < len(overlay.Sections) && isNested(s.TableName(), overlay.Sections[j]) {
+				j++
+			}
+			m.mergeElement(overlay.Sections[i:j])
+			i = j - 1
+		}
+		return errors.Join(m.errs...)
+	}
+}
+
+type merger struct {
+	MergeOptions
+	doc      *tomledit.Document
+	replaced map[string]bool // array tables whose base elements were removed
+	errs     []error
+}
+
+func (m *merger) fail(key parser.Key, msg string, args ...any) {
+	m.errs = append(m.errs, fmt.Errorf("key %q: %s", key, fmt.Sprintf(msg, args...)))
+}
+
+// isNested reports whether s is a table nested inside an array table element
+// with the given name.
+func isNested(name parser.Key, s *tomledit.Section) bool {
+	sname := s.TableName()
+	return len(sname) > len(name) && name.IsPrefixOf(sname)
+}
+
+// mergeSection merges the mappings of an ordinary table section from the
+// overlay into the corresponding table of the base document.
+func (m *merger) mergeSection(s *tomledit.Section) {
+	if s == nil {
+		return
+	}
+	name := s.TableName()
+	var tab *tomledit.Section
+	if s.IsGlobal() {
+		tab = m.doc.Global
+	} else if cur := m.doc.First(name...); cur != nil {
+		if !cur.IsSection() || cur.IsArray {
+			m.fail(name, "cannot merge a table with an existing value")
+			return
+		}
+		tab = cur.Section
+	}
+	if tab == nil {
+		// The table does not exist in the base: Add a new section for it,
+		// without the mappings, which are merged below.
+		tab = &tomledit.Section{Heading: s.Heading}
+		if s.IsGlobal() {
+			m.doc.Global = tab
+		} else {
+			m.doc.Sections = append(m.doc.Sections, tab)
+		}
+	}
+
+	for _, item := range s.Items {
+		kv, ok := item.(*parser.KeyValue)
+		if !ok {
+			continue
+		}
+		full := append(append(parser.Key(nil), name...), kv.Name...)
+		m.mergeMapping(tab, full, kv)
+	}
+}
+
+// mergeMapping merges kv, whose full key is full, into the table section tab
+// of the base document.
+func (m *merger) mergeMapping(tab *tomledit.Section, full parser.Key, kv *parser.KeyValue) {
+	if cur := m.doc.First(full...); cur != nil {
+		if cur.IsSection() {
+			m.fail(full, "cannot replace a table with a value")
+			return
+		}
+		old, isOld := cur.Value.X.(parser.Array)
+		add, isAdd := kv.Value.X.(parser.Array)
+		if m.AppendArrays && isOld && isAdd {
+			cur.Value.X = append(slices.Clone(old), add...)
+		} else {
+			cur.Value.X = kv.Value.X
+		}
+		if m.OverlayComments {
+			cur.Block = kv.Block
+			cur.Value.Trailer = kv.Value.Trailer
+		}
+		return
+	}
+
+	// Adding a dotted key is not possible if one of its prefixes is already
+	// defined as a value.
+	for i := len(full) - len(kv.Name) + 1; i < len(full); i++ {
+		if cur := m.doc.First(full[:i]...); cur != nil && cur.IsMapping() {
+			m.fail(full, "%q is not a table", full[:i])
+			return
+		}
+	}
+	cp := *kv
+	InsertMapping(tab, &cp, false)
+}
+
+// mergeElement adds an element of an array table from the overlay, along with
+// the tables nested inside it, to the end of the base document. Unless
+// AppendArrays is set, the existing elements of the array are first removed.
+func (m *merger) mergeElement(elt []*tomledit.Section) {
+	name := elt[0].TableName()
+	if cur := m.doc.First(name...); cur != nil && (!cur.IsSection() || !cur.IsArray) {
+		m.fail(name, "cannot merge an array table with an existing value")
+		return
+	}
+	if key := name.String(); !m.AppendArrays && !m.replaced[key] {
+		m.replaced[key] = true
+		var keep []*tomledit.Section
+		inElement := false
+		for _, s := range m.doc.Sections {
+			if s.IsArray && s.TableName().Equals(name) {
+				inElement = true
+				continue
+			} else if inElement && isNested(name, s) {
+				continue
+			}
+			inElement = false
+			keep = append(keep, s)
+		}
+		m.doc.Sections = keep
+	}
+	for _, s := range elt {
+		m.doc.Sections = append(m.doc.Sections, &tomledit.Section{
+			Heading: s.Heading,
+			Items:   slices.Clone(s.Items),
+		})
+	}
+}
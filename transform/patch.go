@@ -0,0 +1,131 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package transform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/creachadair/tomledit"
+	"github.com/creachadair/tomledit/parser"
+)
+
+// MapOptions are options for ApplyMap. A nil *MapOptions provides defaults.
+type MapOptions struct {
+	// If true, a nested map whose key does not name an existing table is added
+	// as an inline table value. By default, such maps are added as new sections.
+	InlineTables bool
+}
+
+// ApplyMap sets the keys of doc to the values in patch. Each key of patch is a
+// single key segment, and a value of type map[string]any denotes the contents
+// of a table, so that for example
+//
+//	map[string]any{"server": map[string]any{"port": 8080}}
+//
+// sets server.port to 8080. Other values are converted by parser.ValueOf.
+//
+// Existing mappings are updated in place, retaining their comments, and new
+// mappings are added to the end of the table that contains them.  Tables that
+// do not exist are added as new sections at the end of the document, or as
+// inline tables if opts.InlineTables is true. Keys are processed in sorted
+// order, so the result does not depend on the order of map iteration.
+//
+// All keys are attempted before reporting an error for any values that could
+// not be converted, or keys that could not be set because they conflict with
+// the structure of doc.
+func ApplyMap(patch map[string]any, opts *MapOptions) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		var p patcher
+		if opts != nil {
+			p.MapOptions = *opts
+		}
+		p.apply(doc, nil, patch)
+		return errors.Join(p.errs...)
+	}
+}
+
+type patcher struct {
+	MapOptions
+	errs []error
+}
+
+func (p *patcher) fail(key parser.Key, msg string, args ...any) {
+	p.errs = append(p.errs, fmt.Errorf("key %q: %s", key, fmt.Sprintf(msg, args...)))
+}
+
+func (p *patcher) apply(doc *tomledit.Document, base parser.Key, m map[string]any) {
+	// Set plain values before descending into nested tables, so that any new
+	// table for base is added before new tables nested inside it.
+	var nested []string
+	for _, name := range slices.Sorted(maps.Keys(m)) {
+		key := append(append(parser.Key(nil), base...), name)
+		if _, isMap := m[name].(map[string]any); isMap {
+			nested = append(nested, name)
+		} else {
+			p.set(doc, key, m[name])
+		}
+	}
+	for _, name := range nested {
+		key := append(append(parser.Key(nil), base...), name)
+		sub := m[name].(map[string]any)
+		cur := doc.First(key...)
+		if cur == nil && p.InlineTables {
+			p.set(doc, key, sub)
+		} else if cur == nil && len(sub) == 0 {
+			doc.Sections = append(doc.Sections, &tomledit.Section{
+				Heading: &parser.Heading{Name: key},
+			})
+		} else {
+			p.apply(doc, key, sub)
+		}
+	}
+}
+
+func (p *patcher) set(doc *tomledit.Document, key parser.Key, v any) {
+	val, err := parser.ValueOf(v)
+	if err != nil {
+		p.fail(key, "%v", err)
+		return
+	}
+
+	// If the key already exists, update its value in place.
+	if cur := doc.First(key...); cur != nil {
+		if cur.IsSection() {
+			p.fail(key, "cannot replace a table with a value")
+		} else {
+			cur.Value.X = val.X
+		}
+		return
+	}
+
+	// Otherwise, add a new mapping to the enclosing table.
+	kv := &parser.KeyValue{Name: key[len(key)-1:], Value: val}
+	if len(key) == 1 {
+		if doc.Global == nil {
+			doc.Global = new(tomledit.Section)
+		}
+		InsertMapping(doc.Global, kv, false)
+		return
+	}
+	tab := key[:len(key)-1]
+	switch par := doc.First(tab...); {
+	case par == nil:
+		doc.Sections = append(doc.Sections, &tomledit.Section{
+			Heading: &parser.Heading{Name: tab},
+			Items:   []parser.Item{kv},
+		})
+	case par.IsSection():
+		InsertMapping(par.Section, kv, false)
+	default:
+		in, ok := par.Value.X.(parser.Inline)
+		if !ok {
+			p.fail(key, "%q is not a table", tab)
+			return
+		}
+		par.Value.X = append(in, kv)
+	}
+}
@@ -3,14 +3,20 @@
 package transform_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/creachadair/tomledit"
 	"github.com/creachadair/tomledit/parser"
 	"github.com/creachadair/tomledit/transform"
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestTransform(t *testing.T) {
@@ -192,3 +198,1860 @@ white.rabbit=true
 		}
 	})
 }
+
+func mustParse(t *testing.T, s string) *tomledit.Document {
+	t.Helper()
+	doc, err := tomledit.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Logf("Input:\n%s", s)
+		t.Fatalf("Parse failed: %v", err)
+	}
+	return doc
+}
+
+// checkApply applies tr to the document parsed from input, and checks that
+// the formatted result matches want (modulo leading and trailing space).
+func checkApply(t *testing.T, input, want string, tr transform.Applier) {
+	t.Helper()
+	doc := mustParse(t, input)
+	if err := tr.Apply(context.Background(), doc); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tomledit.Format(&buf, doc); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	if diff := cmp.Diff(want, strings.TrimSpace(buf.String())); diff != "" {
+		t.Errorf("Wrong output: (-want, +got)\n%s", diff)
+	}
+}
+
+func TestConsolidateDotted(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		checkApply(t, `# top
+title = "x"
+# about timeout
+server.timeout = 5
+server.tls.cert = "c"
+other.thing = true
+
+[server]
+port = 80
+
+[server.tls]
+key = "k"
+
+# end
+`, `# top
+title = "x"
+other.thing = true
+
+[server]
+port = 80
+
+# about timeout
+timeout = 5
+
+[server.tls]
+key = "k"
+cert = "c"
+
+# end`, transform.ConsolidateDotted())
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		doc := mustParse(t, "a.b = 1\na.c = 2\n[a]\nb = 3\n")
+		err := transform.ConsolidateDotted().Apply(context.Background(), doc)
+		if err == nil {
+			t.Fatal("Apply: got nil, want error")
+		}
+		if e := doc.First("a", "b"); e == nil || !e.IsGlobal() {
+			t.Errorf("Duplicate key a.b: got %v, want global mapping", e)
+		}
+		if e := doc.First("a", "c"); e == nil || e.IsGlobal() {
+			t.Errorf("Key a.c: got %v, want moved mapping", e)
+		}
+	})
+}
+
+func TestEnvOverride(t *testing.T) {
+	env := map[string]string{
+		"APP_TITLE":          `"new title"`,
+		"APP_SERVER_PORT":    `9000`,
+		"APP_SERVER_MAX_CON": `[1, 2]`,
+		"APP_SERVER_ABSENT":  `true`,
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		checkApply(t, `title = "old"
+[server]
+port = 80 # the port
+max-con = 5
+host = "localhost"
+`, `title = "new title"
+
+[server]
+port = 9000  # the port
+max-con = [1, 2]
+host = "localhost"`, transform.EnvOverride("APP_", lookup))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		env["APP_SERVER_HOST"] = "bare words"
+		defer delete(env, "APP_SERVER_HOST")
+
+		doc := mustParse(t, "[server]\nhost = 'x'\nport = 1\n")
+		err := transform.EnvOverride("APP_", lookup).Apply(context.Background(), doc)
+		if err == nil || !strings.Contains(err.Error(), "APP_SERVER_HOST") {
+			t.Errorf("Apply: got %v, want error mentioning APP_SERVER_HOST", err)
+		}
+		if got := doc.First("server", "port").Value.String(); got != "9000" {
+			t.Errorf("Port: got %q, want 9000", got)
+		}
+	})
+}
+
+func TestNormalizeKeyStyle(t *testing.T) {
+	const input = `maxConnCount = 1
+HTTPServer = 2
+"ipv4Addr" = 3
+"with space" = 4
+[table_name.sub-table]
+old_style-key = 5
+ProperNoun = 6
+`
+	noProper := func(key parser.Key) bool {
+		return key[len(key)-1] == "ProperNoun"
+	}
+	tests := []struct {
+		style transform.KeyStyle
+		want  string
+	}{
+		{transform.SnakeCase, `max_conn_count = 1
+http_server = 2
+ipv4_addr = 3
+"with space" = 4
+
+[table_name.sub_table]
+old_style_key = 5
+ProperNoun = 6`},
+		{transform.KebabCase, `max-conn-count = 1
+http-server = 2
+ipv4-addr = 3
+"with space" = 4
+
+[table-name.sub-table]
+old-style-key = 5
+ProperNoun = 6`},
+		{transform.CamelCase, `maxConnCount = 1
+httpServer = 2
+ipv4Addr = 3
+"with space" = 4
+
+[tableName.subTable]
+oldStyleKey = 5
+ProperNoun = 6`},
+		{transform.LowerCase, `maxconncount = 1
+httpserver = 2
+ipv4addr = 3
+"with space" = 4
+
+[table_name.sub-table]
+old_style-key = 5
+ProperNoun = 6`},
+	}
+	for _, test := range tests {
+		checkApply(t, input, test.want, transform.NormalizeKeyStyle(test.style, noProper))
+	}
+}
+
+func TestTrimTrailingSpace(t *testing.T) {
+	const input = "# head   \n" +
+		"# more\t\n" +
+		"\n" +
+		"a = \"\"\"x  \ny\\t\\t\nz\\   \nw\"\"\"  # trail  \n" +
+		"b = '''p \t\nq'''\n" +
+		"c = '''no trailing space'''\n" +
+		"d = [1,  # one  \n2]\n" +
+		"[t]   # table  \n"
+	const want = "# head\n" +
+		"# more\n" +
+		"\n" +
+		"a = \"\"\"x\\u0020\\u0020\ny\\t\\t\nz\\\nw\"\"\"  # trail\n" +
+		"b = \"\"\"p \\t\nq\"\"\"\n" +
+		"c = '''no trailing space'''\n" +
+		"d = [\n" +
+		"  1,  # one\n" +
+		"  2,\n" +
+		"]\n" +
+		"\n" +
+		"[t]  # table"
+	checkApply(t, input, want, transform.TrimTrailingSpace())
+
+	// Verify that no output line ends in whitespace.
+	doc := mustParse(t, input)
+	if err := transform.TrimTrailingSpace().Apply(context.Background(), doc); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tomledit.Format(&buf, doc); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	for i, line := range strings.Split(buf.String(), "\n") {
+		if strings.TrimRight(line, " \t") != line {
+			t.Errorf("Line %d has trailing space: %q", i+1, line)
+		}
+	}
+}
+
+func TestExpandLargeInline(t *testing.T) {
+	checkApply(t, `small = {a = 1}
+# about big
+big = {a = 1, b = 2, c = {x = 1, y = 2, z = 3}, d = {p = 0}}  # trailer
+[t]
+n.m = {a = 1, b = 2, c = 3}
+last = true
+[u]
+ok = {}
+`, `small = {a = 1}
+
+# about big
+[big]  # trailer
+a = 1
+b = 2
+d = {p = 0}
+
+[big.c]
+x = 1
+y = 2
+z = 3
+
+[t]
+last = true
+
+[t.n.m]
+a = 1
+b = 2
+c = 3
+
+[u]
+ok = {}`, transform.ExpandLargeInline(2))
+}
+
+func TestRenameKeysRegexp(t *testing.T) {
+	const input = `x_alpha = 1
+x_beta.x_gamma = 2
+delta = {x_eps = 3}
+[x_table.other]
+x_key = 4
+`
+	t.Run("Segment", func(t *testing.T) {
+		checkApply(t, input, `alpha = 1
+beta.gamma = 2
+delta = {eps = 3}
+
+[table.other]
+key = 4`, transform.RenameKeysRegexp(regexp.MustCompile(`^x_(.*)$`), "$1"))
+	})
+	t.Run("Full", func(t *testing.T) {
+		checkApply(t, input, `x_alpha = 1
+gamma.beta = 2
+delta = {x_eps = 3}
+
+[x_table.other]
+x_key = 4`, transform.RenameFullKeysRegexp(regexp.MustCompile(`^x_(\w+)\.x_(\w+)$`), "$2.$1"))
+		checkApply(t, "a.b = 1\n[c.d]\n", "b.a = 1\n\n[d.c]",
+			transform.RenameFullKeysRegexp(regexp.MustCompile(`^(\w+)\.(\w+)$`), "$2.$1"))
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		doc := mustParse(t, "a = 1\nb = 2\n")
+		err := transform.RenameFullKeysRegexp(regexp.MustCompile(`^a$`), "a..").Apply(context.Background(), doc)
+		if err == nil {
+			t.Fatal("Apply: got nil, want error")
+		}
+		if doc.First("a") == nil {
+			t.Error("Invalid rename should leave key unchanged")
+		}
+	})
+}
+
+func TestNormalizeDateTimeLiterals(t *testing.T) {
+	checkApply(t, `a = 1979-05-27t07:32:00z
+b = 1979-05-27 07:32:00.500+00:00
+c = 1979-05-27T07:32:00.123000-07:00
+d = [1979-05-27 00:32:00.0, 07:32:00.999000]
+e = {f = 1979-05-27}
+g = "1979-05-27 not a date"
+`, `a = 1979-05-27T07:32:00Z
+b = 1979-05-27T07:32:00.5Z
+c = 1979-05-27T07:32:00.123-07:00
+d = [1979-05-27T00:32:00, 07:32:00.999]
+e = {f = 1979-05-27}
+g = "1979-05-27 not a date"`, transform.NormalizeDateTimeLiterals())
+
+	t.Run("Invalid", func(t *testing.T) {
+		doc := mustParse(t, "a = 2021-13-01\nb = 25:00:00\nc = 2021-01-01 01:01:01\n")
+		err := transform.NormalizeDateTimeLiterals().Apply(context.Background(), doc)
+		if err == nil {
+			t.Fatal("Apply: got nil, want error")
+		}
+		t.Logf("Apply correctly failed: %v", err)
+		if got := doc.First("c").Value.String(); got != "2021-01-01T01:01:01" {
+			t.Errorf("Value c: got %q, want normalized", got)
+		}
+	})
+}
+
+func TestEnforceLineWidth(t *testing.T) {
+	checkApply(t, `# This block comment is long enough that it must be wrapped to fit.
+[tab] # this trailing comment does not fit on the line
+s = "the quick brown fox jumps over  the lazy dog"
+t = 'short'
+`, `# This block comment is long
+# enough that it must be
+# wrapped to fit.
+# this trailing comment does
+# not fit on the line
+[tab]
+s = """the quick brown fox \
+jumps over  the lazy dog"""
+t = 'short'`, transform.EnforceLineWidth(tomledit.Formatter{MaxLineWidth: 30}))
+
+	t.Run("Arrays", func(t *testing.T) {
+		f := tomledit.Formatter{MaxLineWidth: 24}
+		doc := mustParse(t, `a = [1, 2, 3]
+b = [1000, 2000, 3000, 4000]  # long
+c = [[1, 2], [10000, 20000, 30000, 40000]]
+`)
+		if err := transform.EnforceLineWidth(f).Apply(context.Background(), doc); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := f.Format(&buf, doc); err != nil {
+			t.Fatalf("Format failed: %v", err)
+		}
+		const want = `a = [1, 2, 3]
+b = [
+  1000,
+  2000,
+  3000,
+  4000,
+]  # long
+c = [
+  [1, 2],
+  [
+    10000,
+    20000,
+    30000,
+    40000,
+  ],
+]`
+		if diff := cmp.Diff(want, strings.TrimSpace(buf.String())); diff != "" {
+			t.Errorf("Wrong output: (-want, +got)\n%s", diff)
+		}
+	})
+
+	t.Run("BadWidth", func(t *testing.T) {
+		doc := mustParse(t, "a = 1\n")
+		if err := transform.EnforceLineWidth(tomledit.Formatter{}).Apply(context.Background(), doc); err == nil {
+			t.Error("Apply: got nil, want error")
+		}
+	})
+
+	t.Run("Unwrappable", func(t *testing.T) {
+		doc := mustParse(t, `[x]
+a = {p = 1, q = 2, r = 3}
+b = "averyveryverylongword"
+c = 1
+`)
+		err := transform.EnforceLineWidth(tomledit.Formatter{MaxLineWidth: 20}).Apply(context.Background(), doc)
+		if err == nil {
+			t.Fatal("Apply: got nil, want error")
+		}
+		for _, key := range []string{"x.a", "x.b"} {
+			if !strings.Contains(err.Error(), strconv.Quote(key)) {
+				t.Errorf("Error %q does not mention %q", err, key)
+			}
+		}
+		if strings.Contains(err.Error(), `"x.c"`) {
+			t.Errorf("Error %q mentions x.c", err)
+		}
+	})
+}
+
+func TestSetGeneratedBanner(t *testing.T) {
+	banner := transform.SetGeneratedBanner([]string{"Generated by foo", "DO NOT EDIT"}, false)
+	checkApply(t, `# Other comment
+
+a = 1
+`, `# Generated by foo
+# DO NOT EDIT
+
+# Other comment
+
+a = 1`, banner)
+	checkApply(t, `# Generated by foo
+# an old banner
+
+[x]
+a = 1
+`, `# Generated by foo
+# DO NOT EDIT
+
+[x]
+a = 1`, banner)
+
+	t.Run("Timestamp", func(t *testing.T) {
+		doc := mustParse(t, "a = 1\n")
+		tr := transform.SetGeneratedBanner([]string{"# Generated by foo"}, true)
+		for i := 0; i < 2; i++ {
+			if err := tr.Apply(context.Background(), doc); err != nil {
+				t.Fatalf("Apply: unexpected error: %v", err)
+			}
+		}
+		if n := len(doc.Global.Items); n != 2 {
+			t.Fatalf("Got %d global items, want 2 (banner stacked?)", n)
+		}
+		got := doc.Global.Items[0].(parser.Comments)
+		if len(got) != 2 || got[0] != "# Generated by foo" {
+			t.Fatalf("Banner: got %q, want 2 lines", got)
+		}
+		if _, err := time.Parse(time.RFC3339, strings.TrimPrefix(got[1], "# ")); err != nil {
+			t.Errorf("Timestamp %q: %v", got[1], err)
+		}
+	})
+
+	t.Run("TimestampOnly", func(t *testing.T) {
+		// A banner written at an earlier time is replaced, not stacked.
+		doc := mustParse(t, "# 2001-02-03T04:05:06Z\n\n# Other.\n\na = 1\n")
+		tr := transform.SetGeneratedBanner(nil, true)
+		for i := 0; i < 2; i++ {
+			if err := tr.Apply(context.Background(), doc); err != nil {
+				t.Fatalf("Apply: unexpected error: %v", err)
+			}
+		}
+		if n := len(doc.Global.Items); n != 3 {
+			t.Fatalf("Got %d global items, want 3 (banner stacked?)", n)
+		}
+		got := doc.Global.Items[0].(parser.Comments)
+		if len(got) != 1 || got[0] == "# 2001-02-03T04:05:06Z" {
+			t.Fatalf("Banner: got %q, want a new timestamp", got)
+		}
+		if diff := cmp.Diff(parser.Comments{"# Other."}, doc.Global.Items[1]); diff != "" {
+			t.Errorf("Other comments (-want, +got):\n%s", diff)
+		}
+	})
+}
+
+func TestZipToArrayTable(t *testing.T) {
+	fields := map[string]parser.Key{
+		"port": {"ports"},
+		"name": {"svc", "names"},
+	}
+	checkApply(t, `ports = [80, 443]  # ports
+other = true
+
+[svc]
+names = ["http", "https"]
+
+[[entry]]
+name = "ssh"
+port = 22
+
+[after]
+`, `other = true
+
+[svc]
+
+[[entry]]
+name = "ssh"
+port = 22
+
+[[entry]]
+name = "http"
+port = 80
+
+[[entry]]
+name = "https"
+port = 443
+
+[after]`, transform.ZipToArrayTable(fields, parser.Key{"entry"}))
+	t.Run("Mismatch", func(t *testing.T) {
+		const input = "ports = [1, 2]\nnames = ['a']\n"
+		doc := mustParse(t, input)
+		tr := transform.ZipToArrayTable(map[string]parser.Key{
+			"port": {"ports"},
+			"name": {"names"},
+		}, parser.Key{"entry"})
+		if err := tr.Apply(context.Background(), doc); err == nil {
+			t.Fatal("Apply: got nil, want error")
+		} else {
+			t.Logf("Apply correctly failed: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := tomledit.Format(&buf, doc); err != nil {
+			t.Fatalf("Format: %v", err)
+		}
+		if got := buf.String(); got != input {
+			t.Errorf("Document was modified: got %q, want %q", got, input)
+		}
+	})
+}
+
+func TestSimplifyKeyQuoting(t *testing.T) {
+	doc := mustParse(t, "\"x\" = 1\n[t]\ny = {'z' = 2}\n")
+	doc.Sections[0].Heading.Name = parser.Key{`"simple"`, `'a.b'`}
+	doc.First("x").Name = parser.Key{`"x"`, `""`, `"q\"uote"`}
+	doc.Sections[0].Items[0].(*parser.KeyValue).Name = parser.Key{`"y"`, "plain", `"`}
+
+	if err := transform.SimplifyKeyQuoting().Apply(context.Background(), doc); err != nil {
+		t.Fatalf("Apply: unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tomledit.Format(&buf, doc); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	const want = `x.""."q\"uote" = 1
+
+[simple."a.b"]
+y.plain."\"" = {z = 2}`
+	if diff := cmp.Diff(want, strings.TrimSpace(buf.String())); diff != "" {
+		t.Errorf("Wrong output: (-want, +got)\n%s", diff)
+	}
+}
+
+func TestEnsureComment(t *testing.T) {
+	warn := transform.EnsureComment(parser.Key{"t", "port"}, parser.Comments{"Changing this requires a restart"})
+	const want = `[t]
+
+# Changing this requires a restart
+port = 80`
+	checkApply(t, "[t]\nport = 80\n", want, warn)
+	checkApply(t, "[t]\n# old comment\nport = 80\n", want, warn)
+	checkApply(t, want, want, transform.Plan{{T: warn}, {T: warn}})
+	checkApply(t, "# old\n[t]\n", "# new\n[t]",
+		transform.EnsureComment(parser.Key{"t"}, parser.Comments{"new"}))
+
+	t.Run("Errors", func(t *testing.T) {
+		doc := mustParse(t, "a = {b = 1}\n")
+		for _, key := range []parser.Key{{"x"}, {"a", "b"}} {
+			tr := transform.EnsureComment(key, parser.Comments{"c"})
+			if err := tr.Apply(context.Background(), doc); err == nil {
+				t.Errorf("EnsureComment %q: got nil, want error", key)
+			}
+		}
+	})
+}
+
+func TestSectionsToArrayTable(t *testing.T) {
+	tr := transform.SectionsToArrayTable(parser.Key{"services"}, "name", parser.Key{"service"})
+	checkApply(t, `[first]
+a = 1
+
+# The web service.
+[services.web]
+port = 80
+
+[services.api.tls]
+cert = "x.pem"
+
+[services.web.tls]
+cert = "y.pem"
+
+[services.api]
+port = 8080
+
+[last]
+`, `[first]
+a = 1
+
+# The web service.
+[[service]]
+name = "web"
+port = 80
+
+[service.tls]
+cert = "y.pem"
+
+[[service]]
+name = "api"
+port = 8080
+
+[service.tls]
+cert = "x.pem"
+
+[last]`, tr)
+
+	t.Run("Errors", func(t *testing.T) {
+		for _, input := range []string{
+			"[services.web]\nname = 'www'\n",
+			"[[services.web]]\nport = 80\n",
+		} {
+			doc := mustParse(t, input)
+			if err := tr.Apply(context.Background(), doc); err == nil {
+				t.Errorf("Apply %q: got nil, want error", input)
+			}
+		}
+	})
+}
+
+func TestSortNatural(t *testing.T) {
+	checkApply(t, `node10 = 3
+node2 = 2
+# stay
+
+node1 = 1
+
+[s10]
+[s9]
+[s1]
+`, `node1 = 1
+node2 = 2
+
+# stay
+
+node10 = 3
+
+[s1]
+
+[s9]
+
+[s10]`, transform.Func(func(_ context.Context, doc *tomledit.Document) error {
+		transform.SortKeyValuesByNameFunc(doc.Global.Items, parser.Key.BeforeNatural)
+		transform.SortSectionsByNameFunc(doc.Sections, parser.Key.BeforeNatural)
+		return nil
+	}))
+}
+
+func TestApplyMap(t *testing.T) {
+	patch := map[string]any{
+		"name": "demo",
+		"server": map[string]any{
+			"port":  8080,
+			"hosts": []string{"a", "b"},
+			"tls":   map[string]any{"enabled": true},
+		},
+		"limits": map[string]any{"rate": 2.0, "opts": map[string]any{"x": 1}},
+		"empty":  map[string]any{},
+	}
+	checkApply(t, `# Top comment.
+name = "old"  # keep me
+
+# The server.
+[server]
+port = 80  # the port
+`, `# Top comment.
+name = "demo"  # keep me
+
+# The server.
+[server]
+port = 8080  # the port
+hosts = ["a", "b"]
+
+[empty]
+
+[limits]
+rate = 2.0
+
+[limits.opts]
+x = 1
+
+[server.tls]
+enabled = true`, transform.ApplyMap(patch, nil))
+
+	checkApply(t, `[server]
+port = 80
+`, `name = "demo"
+empty = {}
+limits = {opts = {x = 1}, rate = 2.0}
+
+[server]
+port = 8080
+hosts = ["a", "b"]
+tls = {enabled = true}`, transform.ApplyMap(patch, &transform.MapOptions{InlineTables: true}))
+
+	t.Run("Errors", func(t *testing.T) {
+		doc := mustParse(t, "a = 1\n[t]\n")
+		err := transform.ApplyMap(map[string]any{
+			"a": map[string]any{"b": 2},
+			"t": 3,
+			"u": struct{}{},
+			"v": "ok",
+		}, nil).Apply(context.Background(), doc)
+		if err == nil {
+			t.Fatal("Apply: got nil, want error")
+		}
+		t.Logf("Apply correctly failed: %v", err)
+		if got := doc.First("v").Value.String(); got != `"ok"` {
+			t.Errorf("Value v: got %s, want %q", got, "ok")
+		}
+	})
+}
+
+func TestCheckTableArrayConflicts(t *testing.T) {
+	ok := mustParse(t, "[a]\n[[b]]\n[[b]]\n[a.c]\n")
+	if err := transform.CheckTableArrayConflicts().Apply(context.Background(), ok); err != nil {
+		t.Errorf("Apply: unexpected error: %v", err)
+	}
+
+	bad := mustParse(t, "[x]\na = 1\n\n[[y]]\n[[x]]\n[y]\n[[x]]\n")
+	err := transform.CheckTableArrayConflicts().Apply(context.Background(), bad)
+	if err == nil {
+		t.Fatal("Apply: got nil, want error")
+	}
+	for _, want := range []string{
+		`"x" is a table at line 1 and an array table at line 5`,
+		`"y" is a table at line 6 and an array table at line 4`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Error %q does not contain %q", err, want)
+		}
+	}
+}
+
+func TestNormalizeMultilineStrings(t *testing.T) {
+	const input = "a = \"\"\"one\r\ntwo \\\n   three\"\"\"\n" +
+		"b = '''\nraw \\n'''\n" +
+		"c = \"\"\"\n\nbell\\u0007\"\"\"\n" +
+		"d = '''it's'''\n"
+
+	checkApply(t, input, "a = \"\"\"\none\ntwo \\\n   three\"\"\"\n"+
+		"b = '''\nraw \\n'''\n"+
+		"c = \"\"\"\n\nbell\\u0007\"\"\"\n"+
+		"d = '''\nit's'''",
+		transform.NormalizeMultilineStrings(transform.MultilineOptions{
+			LeadingNewline:    true,
+			NormalizeNewlines: true,
+		}))
+
+	checkApply(t, input, "a = \"\"\"one\r\ntwo \\\n   three\"\"\"\n"+
+		"b = \"\"\"raw \\\\n\"\"\"\n"+
+		"c = \"\"\"\n\nbell\\u0007\"\"\"\n"+
+		"d = \"\"\"it's\"\"\"",
+		transform.NormalizeMultilineStrings(transform.MultilineOptions{Form: transform.BasicForm}))
+
+	checkApply(t, input, "a = '''\none\ntwo three'''\n"+
+		"b = '''\nraw \\n'''\n"+
+		"c = \"\"\"\n\nbell\\u0007\"\"\"\n"+
+		"d = '''\nit's'''",
+		transform.NormalizeMultilineStrings(transform.MultilineOptions{
+			Form:              transform.LiteralForm,
+			LeadingNewline:    true,
+			NormalizeNewlines: true,
+		}))
+
+	t.Run("Content", func(t *testing.T) {
+		for _, opts := range []transform.MultilineOptions{
+			{Form: transform.BasicForm},
+			{Form: transform.LiteralForm},
+			{Form: transform.BasicForm, LeadingNewline: true},
+			{Form: transform.LiteralForm, LeadingNewline: true},
+		} {
+			doc := mustParse(t, input)
+			before := doc.Strings()
+			if err := transform.NormalizeMultilineStrings(opts).Apply(context.Background(), doc); err != nil {
+				t.Fatalf("Apply: unexpected error: %v", err)
+			}
+			for i, ref := range doc.Strings() {
+				if ref.Value != before[i].Value {
+					t.Errorf("Options %+v: %s changed from %q to %q", opts, ref.Key, before[i].Value, ref.Value)
+				}
+			}
+		}
+	})
+}
+
+func TestGroupArrayTables(t *testing.T) {
+	checkApply(t, `[other]
+x = 1
+
+# First peer.
+[[peer]]
+id = 1
+
+[peer.opts]
+a = true
+
+[misc]
+
+[[peer]]
+id = 2
+
+[peer2]
+
+# Third peer.
+[[peer]]
+id = 3
+
+[[peer.addr]]
+ip = "::1"
+
+[last]
+`, `[other]
+x = 1
+
+# First peer.
+[[peer]]
+id = 1
+
+[peer.opts]
+a = true
+
+[[peer]]
+id = 2
+
+# Third peer.
+[[peer]]
+id = 3
+
+[[peer.addr]]
+ip = "::1"
+
+[misc]
+
+[peer2]
+
+[last]`, transform.GroupArrayTables(parser.Key{"peer"}))
+}
+
+func TestCheckReferences(t *testing.T) {
+	doc := mustParse(t, `root = "/etc"
+cert = "${paths.cert}"
+list = ["${root}/a", "${ paths.key }", "${nope}"]
+
+[paths]
+cert = "${root}/cert.pem"
+key = '${paths.missing}'
+`)
+	err := transform.CheckReferences(nil).Apply(context.Background(), doc)
+	if err == nil {
+		t.Fatal("Apply: got nil, want error")
+	}
+	const want = "unresolved references: ${nope} (in list), ${paths.missing} (in paths.key)"
+	if got := err.Error(); got != want {
+		t.Errorf("Apply: got error %q, want %q", got, want)
+	}
+
+	all := func(string) bool { return true }
+	if err := transform.CheckReferences(all).Apply(context.Background(), doc); err != nil {
+		t.Errorf("Apply: unexpected error: %v", err)
+	}
+}
+
+func TestAlignArrayRecords(t *testing.T) {
+	tr := transform.AlignArrayRecords(parser.Key{"t", "servers"}, []string{"host", "port"})
+	checkApply(t, `[t]
+servers = [
+  {port = 80, host = "a"},
+  {x = 1, host = "b", y.z = 2, port = 81},  # trailer
+  "other",
+  {host = "c"},
+  {},
+]
+`, `[t]
+servers = [
+  {host = "a", port = 80},
+  {host = "b", port = 81, x = 1, y.z = 2},  # trailer
+  "other",
+  {host = "c"},
+  {},
+]`, tr)
+
+	doc := mustParse(t, "[t]\nservers = 1\n")
+	if err := tr.Apply(context.Background(), doc); err == nil {
+		t.Error("Apply: got nil, want error")
+	}
+}
+
+func TestEnsureSection(t *testing.T) {
+	tr := transform.EnsureSection(parser.Key{"a", "b"})
+	checkApply(t, "x = 1\n", "x = 1\n\n[a.b]", tr)
+	checkApply(t, "[a.b]\ny = 2\n\n[c]\n", "[a.b]\ny = 2\n\n[c]", tr)
+	checkApply(t, "[a]\n", "[a]\n\n[a.b]", transform.Plan{{T: tr}, {T: tr}})
+
+	t.Run("Errors", func(t *testing.T) {
+		doc := mustParse(t, "a = {b = 1}\n[[c]]\n")
+		for _, key := range []parser.Key{nil, {"a"}, {"a", "b"}, {"c"}} {
+			if err := transform.EnsureSection(key).Apply(context.Background(), doc); err == nil {
+				t.Errorf("EnsureSection %q: got nil, want error", key)
+			}
+		}
+	})
+}
+
+func TestEnsureKeyPath(t *testing.T) {
+	val := parser.MustValue(`"1.2"`)
+	tr := transform.EnsureKeyPath(parser.Key{"server", "tls", "min-version"}, val)
+
+	// Existing table.
+	checkApply(t, "[server.tls]\ncert = 'x'\n", "[server.tls]\ncert = 'x'\nmin-version = \"1.2\"", tr)
+
+	// Longest prefix table, with a dotted key.
+	checkApply(t, "[server]\nport = 80\n", "[server]\nport = 80\ntls.min-version = \"1.2\"", tr)
+
+	// Inline table.
+	checkApply(t, "server.tls = {cert = 'x'}\n", "server.tls = {cert = 'x', min-version = \"1.2\"}", tr)
+
+	// New section, and idempotence.
+	checkApply(t, "a = 1\n", "a = 1\n\n[server.tls]\nmin-version = \"1.2\"", transform.Plan{{T: tr}, {T: tr}})
+
+	// Existing mapping is retained.
+	checkApply(t, "[server.tls]\nmin-version = '1.3'\n", "[server.tls]\nmin-version = '1.3'", tr)
+
+	// Global mapping.
+	checkApply(t, "[x]\n", "v = \"1.2\"\n\n[x]", transform.EnsureKeyPath(parser.Key{"v"}, val))
+
+	t.Run("Errors", func(t *testing.T) {
+		doc := mustParse(t, "server = 5\nin = {p = {}}\n[a.b]\nc = 5\n[[arr]]\n")
+		for _, key := range []parser.Key{
+			nil, {"server", "x"}, {"a", "b"}, {"server", "a", "b"}, {"a", "b", "c", "d"},
+			{"arr", "x"}, {"arr", "x", "y"}, {"in", "q", "r"},
+		} {
+			if err := transform.EnsureKeyPath(key, val).Apply(context.Background(), doc); err == nil {
+				t.Errorf("EnsureKeyPath %q: got nil, want error", key)
+			}
+		}
+	})
+}
+
+func TestKebabToSnake(t *testing.T) {
+	checkApply(t, `
+top-level = 1
+"not a-name" = 2
+x = {inline-key = 3}
+
+[my-table.sub-table]
+dotted-key.value-name = 4
+
+[[array-table]]
+`, `top_level = 1
+"not a-name" = 2
+x = {inline_key = 3}
+
+[my_table.sub_table]
+dotted_key.value_name = 4
+
+[[array_table]]`, transform.KebabToSnake())
+}
+
+func TestChangeKeyCase(t *testing.T) {
+	const input = `
+Top-Level = 1
+"Not A Name" = 2
+x = {Inline_Key = 3}
+
+[My.Table]
+Dotted.Key = 4
+`
+	checkApply(t, input, `top-level = 1
+"Not A Name" = 2
+x = {inline_key = 3}
+
+[my.table]
+dotted.key = 4`, transform.LowercaseKeys())
+	checkApply(t, input, `TOP-LEVEL = 1
+"Not A Name" = 2
+X = {INLINE_KEY = 3}
+
+[MY.TABLE]
+DOTTED.KEY = 4`, transform.UppercaseKeys())
+}
+
+func TestSortArray(t *testing.T) {
+	checkApply(t, `allow = [
+  # Hosts.
+  "zeta",
+  'alpha',  # first
+  "mike",
+  # Numbers.
+  10,
+  2.5,
+  -1,
+  9007199254740993,
+  9007199254740992,
+  true,
+]`, `allow = [
+  # Hosts.
+  -1,
+  2.5,
+  10,
+  # Numbers.
+  9007199254740992,
+  9007199254740993,
+  'alpha',  # first
+  "mike",
+  "zeta",
+  true,
+]`, transform.SortArray(parser.Key{"allow"}, nil))
+
+	byLength := func(a, b parser.Value) bool { return len(a.String()) < len(b.String()) }
+	checkApply(t, `x = ["ccc", "a", "bb", "d"]`, `x = ["a", "d", "bb", "ccc"]`,
+		transform.SortArray(parser.Key{"x"}, byLength))
+
+	t.Run("Errors", func(t *testing.T) {
+		doc := mustParse(t, "a = 1\n[t]\n")
+		for _, key := range []parser.Key{{"a"}, {"t"}, {"nonesuch"}} {
+			if err := transform.SortArray(key, nil).Apply(context.Background(), doc); err == nil {
+				t.Errorf("SortArray %q: got nil, want error", key)
+			}
+		}
+	})
+}
+
+func TestStripComments(t *testing.T) {
+	const input = `# Banner.
+
+# About a.
+a = 1  # one
+b = [
+  # first
+  1,  # trailer
+  [2, # nested
+   3],
+]
+
+# About t.
+[t]  # table
+c = {d = [4, # inline
+  5]}
+# end
+`
+	checkApply(t, input, `a = 1
+b = [
+  1,
+  [2, 3],
+]
+
+[t]
+c = {d = [4, 5]}`, transform.StripComments())
+
+	checkApply(t, input, `a = 1  # one
+b = [
+  1,  # trailer
+  [
+    2,  # nested
+    3,
+  ],
+]
+
+[t]  # table
+c = {d = [
+  4,  # inline
+  5,
+]}`, transform.StripCommentsOf(transform.BlockComments))
+
+	checkApply(t, input, `# Banner.
+
+# About a.
+a = 1
+b = [
+  # first
+  1,
+  [2, 3],
+]
+
+# About t.
+[t]
+c = {d = [4, 5]}
+
+# end`, transform.StripCommentsOf(transform.TrailingComments))
+}
+
+func TestExpandInline(t *testing.T) {
+	const input = `a = 1
+# About server.
+server = {host = "h", tls = {cert = "c"}, port = 80}  # srv
+other = {x = 1}
+
+[t]
+u = {v = {w = 2}}
+z = 3
+`
+	checkApply(t, input, `a = 1
+other = {x = 1}
+
+# About server.
+[server]  # srv
+host = "h"
+port = 80
+
+[server.tls]
+cert = "c"
+
+[t]
+u = {v = {w = 2}}
+z = 3`, transform.ExpandInline(parser.Key{"server"}))
+
+	checkApply(t, input, `a = 1
+
+# About server.
+[server]  # srv
+host = "h"
+port = 80
+
+[server.tls]
+cert = "c"
+
+[other]
+x = 1
+
+[t]
+z = 3
+
+[t.u]
+
+[t.u.v]
+w = 2`, transform.ExpandAllInline())
+
+	// Only the first mapping for the key is expanded.
+	checkApply(t, `[[p]]
+q = {r = 1, s = {u = 2}}
+
+[[p]]
+q = {r = 3}`, `[[p]]
+
+[p.q]
+r = 1
+
+[p.q.s]
+u = 2
+
+[[p]]
+q = {r = 3}`, transform.ExpandInline(parser.Key{"p", "q"}))
+
+	t.Run("Comments", func(t *testing.T) {
+		opts := tomledit.ParseOptions{MultilineInline: true}
+		doc, err := opts.Parse(strings.NewReader(`s = {
+  # About x.
+  x = 1, # one
+  y = 2
+  # Tail.
+}
+`))
+		if err != nil {
+			t.Fatalf("Parse: %v", err)
+		}
+		if err := transform.ExpandAllInline().Apply(context.Background(), doc); err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := tomledit.Format(&buf, doc); err != nil {
+			t.Fatalf("Format: %v", err)
+		}
+		const want = `[s]
+
+# About x.
+x = 1  # one
+y = 2
+
+# Tail.`
+		if diff := cmp.Diff(want, strings.TrimSpace(buf.String())); diff != "" {
+			t.Errorf("Wrong output: (-want, +got)\n%s", diff)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		doc := mustParse(t, input)
+		for _, key := range []parser.Key{{"a"}, {"t"}, {"nonesuch"}, {"server", "tls"}} {
+			if err := transform.ExpandInline(key).Apply(context.Background(), doc); err == nil {
+				t.Errorf("ExpandInline %q: got nil, want error", key)
+			}
+		}
+	})
+}
+
+func TestCollapseToInline(t *testing.T) {
+	const input = `a = 1
+
+[server]
+name = "s"
+
+# About TLS.
+[server.tls]  # tls
+# The certificate.
+cert = "c"
+key = "k"  # secret
+
+[client]
+b.c = 2
+
+[[list]]
+x = 1
+
+[list.sub]
+y = 2
+
+[outer.inner]
+z = 3`
+
+	checkApply(t, input, `a = 1
+
+[server]
+name = "s"
+
+# About TLS.
+# The certificate.
+# secret
+tls = {cert = "c", key = "k"}  # tls
+
+[client]
+b.c = 2
+
+[[list]]
+x = 1
+
+[list.sub]
+y = 2
+
+[outer.inner]
+z = 3`, transform.CollapseToInline(parser.Key{"server", "tls"}))
+
+	checkApply(t, input, `a = 1
+client = {b.c = 2}
+outer.inner = {z = 3}
+
+[server]
+name = "s"
+
+# About TLS.
+[server.tls]  # tls
+
+# The certificate.
+cert = "c"
+key = "k"  # secret
+
+[[list]]
+x = 1
+
+[list.sub]
+y = 2`, transform.Plan{
+		{T: transform.CollapseToInline(parser.Key{"client"})},
+		{T: transform.CollapseToInline(parser.Key{"outer", "inner"})},
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		doc := mustParse(t, input)
+		for _, key := range []parser.Key{{"a"}, {"nonesuch"}, {"server"}, {"list"}, {"list", "sub"}} {
+			if err := transform.CollapseToInline(key).Apply(context.Background(), doc); err == nil {
+				t.Errorf("CollapseToInline %q: got nil, want error", key)
+			}
+		}
+	})
+
+	t.Run("KeyNotModified", func(t *testing.T) {
+		doc := mustParse(t, "[m]\ns = \"\"\"multi\nline\"\"\"\n")
+		buf := make([]string, 1, 4)
+		buf[0] = "m"
+		key := parser.Key(buf)
+		if err := transform.CollapseToInline(key).Apply(context.Background(), doc); err == nil {
+			t.Error("CollapseToInline: got nil, want error")
+		}
+		if got := buf[:2]; got[1] != "" {
+			t.Errorf("CollapseToInline modified the storage of its key: %q", got)
+		}
+	})
+}
+
+func TestDedupeKeys(t *testing.T) {
+	const input = `a = 1
+b = 2
+a = 3
+
+[t]
+x = 1
+
+[[p]]
+y = 1
+
+[[p]]
+y = 2
+
+# Again.
+[t]
+x = 2
+z = 3
+`
+	const noMerge = `a = 1
+b = 2
+
+[t]
+x = 1
+
+[[p]]
+y = 1
+
+[[p]]
+y = 2
+
+# Again.
+[t]
+x = 2
+z = 3`
+
+	t.Run("KeepFirst", func(t *testing.T) {
+		var got []string
+		doc := mustParse(t, input)
+		err := transform.DedupeKeys(transform.DedupePolicy{
+			Removed: func(key parser.Key) { got = append(got, key.String()) },
+		}).Apply(context.Background(), doc)
+		if err == nil {
+			t.Error("DedupeKeys: got nil, want error for duplicate sections")
+		}
+		if diff := cmp.Diff([]string{"a"}, got); diff != "" {
+			t.Errorf("Removed keys (-want, +got):\n%s", diff)
+		}
+		var buf bytes.Buffer
+		if err := tomledit.Format(&buf, doc); err != nil {
+			t.Fatalf("Format: %v", err)
+		}
+		if diff := cmp.Diff(noMerge, strings.TrimSpace(buf.String())); diff != "" {
+			t.Errorf("Wrong output: (-want, +got)\n%s", diff)
+		}
+	})
+
+	checkApply(t, input, `b = 2
+a = 3
+
+[[p]]
+y = 1
+
+[[p]]
+y = 2
+
+# Again.
+[t]
+x = 2
+z = 3`, transform.DedupeKeys(transform.DedupePolicy{KeepLast: true, MergeSections: true}))
+
+	// Tables in different elements of an array table are not duplicates.
+	const elements = `[[p]]
+
+[p.t]
+x = 1
+
+[[p]]
+
+[p.t]
+x = 2`
+	for _, policy := range []transform.DedupePolicy{
+		{}, {MergeSections: true}, {KeepLast: true, MergeSections: true},
+	} {
+		checkApply(t, elements, elements, transform.DedupeKeys(policy))
+	}
+
+	// A merged section is placed at the occurrence selected by KeepLast.
+	const spread = `[a]
+x = 1
+
+[b]
+y = 2
+
+[a]
+z = 3`
+	checkApply(t, spread, `[a]
+x = 1
+z = 3
+
+[b]
+y = 2`, transform.DedupeKeys(transform.DedupePolicy{MergeSections: true}))
+	checkApply(t, spread, `[b]
+y = 2
+
+[a]
+x = 1
+z = 3`, transform.DedupeKeys(transform.DedupePolicy{KeepLast: true, MergeSections: true}))
+
+	checkApply(t, input, `a = 1
+b = 2
+
+[t]
+x = 1
+z = 3
+
+[[p]]
+y = 1
+
+[[p]]
+y = 2`, transform.DedupeKeys(transform.DedupePolicy{MergeSections: true}))
+}
+
+func TestForEachTable(t *testing.T) {
+	const input = `[[p]]
+x = 1
+
+[q]
+x = 2
+
+[[p]]
+x = 3
+`
+	checkApply(t, input, `[[p]]
+x = 1
+ok = true
+
+[q]
+x = 2
+
+[[p]]
+x = 3
+ok = true`, transform.ForEachTable(parser.Key{"p"}, func(s *tomledit.Section) error {
+		transform.InsertMapping(s, &parser.KeyValue{
+			Name:  parser.Key{"ok"},
+			Value: parser.MustValue("true"),
+		}, false)
+		return nil
+	}))
+
+	t.Run("Error", func(t *testing.T) {
+		var n int
+		doc := mustParse(t, input)
+		err := transform.ForEachTable(parser.Key{"p"}, func(s *tomledit.Section) error {
+			n++
+			return errors.New("bad table")
+		}).Apply(context.Background(), doc)
+		if err == nil || !strings.Contains(err.Error(), "bad table") {
+			t.Errorf("ForEachTable: got %v, want bad table", err)
+		}
+		if n != 1 {
+			t.Errorf("ForEachTable called fn %d times, want 1", n)
+		}
+	})
+}
+
+func TestMoveKeyErrors(t *testing.T) {
+	const input = `a = 1
+b = 2
+
+[t]
+c = 3`
+	for _, tc := range []struct {
+		old, root, new parser.Key
+	}{
+		{parser.Key{"nonesuch"}, parser.Key{"t"}, parser.Key{"x"}},
+		{parser.Key{"t"}, parser.Key{"t"}, parser.Key{"x"}},
+		{parser.Key{"a"}, parser.Key{"nonesuch"}, parser.Key{"x"}},
+		{parser.Key{"a"}, parser.Key{"b"}, parser.Key{"x"}},
+	} {
+		doc := mustParse(t, input)
+		if err := transform.MoveKey(tc.old, tc.root, tc.new).Apply(context.Background(), doc); err == nil {
+			t.Errorf("MoveKey(%q, %q, %q): got nil, want error", tc.old, tc.root, tc.new)
+		}
+
+		// A failed move should not modify the document.
+		var buf bytes.Buffer
+		if err := tomledit.Format(&buf, doc); err != nil {
+			t.Fatalf("Format: %v", err)
+		}
+		if diff := cmp.Diff(input, strings.TrimSpace(buf.String())); diff != "" {
+			t.Errorf("MoveKey(%q, %q, %q) output (-want, +got):\n%s", tc.old, tc.root, tc.new, diff)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	const base = `# Base.
+name = "base"
+list = [1, 2]
+
+[server]
+host = "localhost"  # default host
+port = 80
+
+[[peer]]
+id = 1
+
+[peer.opts]
+x = 1
+
+[[peer]]
+id = 2`
+
+	overlay := mustParse(t, `name = "prod"  # production
+list = [3]
+extra = true
+
+# Server settings.
+[server]
+port = 443
+tls.cert = "c"
+
+[client]
+retry = 3
+
+[[peer]]
+id = 3`)
+
+	checkApply(t, base, `# Base.
+name = "prod"
+list = [3]
+extra = true
+
+[server]
+host = "localhost"  # default host
+port = 443
+tls.cert = "c"
+
+[client]
+retry = 3
+
+[[peer]]
+id = 3`, transform.Merge(overlay, nil))
+
+	overlay = mustParse(t, `name = "prod"  # production
+list = [3]
+extra = true
+
+# Server settings.
+[server]
+port = 443
+tls.cert = "c"
+
+[client]
+retry = 3
+
+[[peer]]
+id = 3`)
+	checkApply(t, base, `name = "prod"  # production
+list = [1, 2, 3]
+extra = true
+
+[server]
+host = "localhost"  # default host
+port = 443
+tls.cert = "c"
+
+[[peer]]
+id = 1
+
+[peer.opts]
+x = 1
+
+[[peer]]
+id = 2
+
+[client]
+retry = 3
+
+[[peer]]
+id = 3`, transform.Merge(overlay, &transform.MergeOptions{
+		AppendArrays:    true,
+		OverlayComments: true,
+	}))
+
+	t.Run("Errors", func(t *testing.T) {
+		doc := mustParse(t, base)
+		overlay := mustParse(t, `server = 1
+name.x = 2
+[list]
+[[server]]`)
+		err := transform.Merge(overlay, nil).Apply(context.Background(), doc)
+		if err == nil {
+			t.Fatal("Merge: got nil, want error")
+		}
+		for _, key := range []string{"server", "name.x", "list"} {
+			if !strings.Contains(err.Error(), fmt.Sprintf("%q", key)) {
+				t.Errorf("Merge error %q does not mention %q", err, key)
+			}
+		}
+	})
+}
+
+func TestExpandEnv(t *testing.T) {
+	env := map[string]string{"HOME": "/home/me", "USER": "me"}
+	lookup := func(name string) (string, bool) { v, ok := env[name]; return v, ok }
+
+	const input = `path = '${HOME}/bin'  # where
+who = "$USER@$HOST"
+n = 5
+list = ["$USER", 3]
+tab = {dir = "${HOME}"}
+raw = """
+${NOPE}"""`
+	const want = `path = "/home/me/bin"  # where
+who = "me@$HOST"
+n = 5
+list = ["me", 3]
+tab = {dir = "/home/me"}
+raw = """
+${NOPE}"""`
+	checkApply(t, input, want, transform.ExpandEnv(lookup))
+
+	t.Run("Strict", func(t *testing.T) {
+		doc := mustParse(t, input)
+		err := transform.ExpandEnvStrict(lookup).Apply(context.Background(), doc)
+		if err == nil {
+			t.Fatal("ExpandEnvStrict: got nil, want error")
+		}
+		for _, name := range []string{"$HOST", "${NOPE}"} {
+			if !strings.Contains(err.Error(), name) {
+				t.Errorf("ExpandEnvStrict error %q does not mention %q", err, name)
+			}
+		}
+	})
+}
+
+func TestOrderKeys(t *testing.T) {
+	const input = `z = 0
+a = 1
+
+[pkg]
+# About deps.
+deps = []
+version = "1.0"  # ver
+
+# Free-standing.
+
+name = "x"
+extra = true
+# At end.
+
+[other]
+name = "y"`
+
+	checkApply(t, input, `z = 0
+a = 1
+
+[pkg]
+
+# Free-standing.
+
+name = "x"
+version = "1.0"  # ver
+
+# About deps.
+deps = []
+extra = true
+
+# At end.
+
+[other]
+name = "y"`, transform.OrderKeys(parser.Key{"pkg"}, []parser.Key{{"name"}, {"version"}, {"missing"}}))
+
+	checkApply(t, input, `a = 1
+z = 0
+
+[pkg]
+
+# About deps.
+deps = []
+version = "1.0"  # ver
+
+# Free-standing.
+
+name = "x"
+extra = true
+
+# At end.
+
+[other]
+name = "y"`, transform.OrderKeys(nil, []parser.Key{{"a"}}))
+
+	doc := mustParse(t, input)
+	if err := transform.OrderKeys(parser.Key{"nonesuch"}, nil).Apply(context.Background(), doc); err == nil {
+		t.Error("OrderKeys: got nil, want error for missing section")
+	}
+}
+
+func TestMoveSection(t *testing.T) {
+	const input = `g = 0
+
+# About a.
+[a]
+x = 1
+
+[b]
+y = 2
+
+[c]  # see
+z = 3`
+
+	checkApply(t, input, `g = 0
+
+[c]  # see
+z = 3
+
+# About a.
+[a]
+x = 1
+
+[b]
+y = 2`, transform.MoveSection(parser.Key{"c"}, parser.Key{"a"}))
+
+	checkApply(t, input, `g = 0
+
+[b]
+y = 2
+
+# About a.
+[a]
+x = 1
+
+[c]  # see
+z = 3`, transform.MoveSection(parser.Key{"a"}, parser.Key{"c"}))
+
+	checkApply(t, input, `g = 0
+
+[b]
+y = 2
+
+[c]  # see
+z = 3
+
+# About a.
+[a]
+x = 1`, transform.MoveSection(parser.Key{"a"}, nil))
+
+	checkApply(t, input, input, transform.MoveSection(parser.Key{"b"}, parser.Key{"b"}))
+
+	t.Run("Errors", func(t *testing.T) {
+		doc := mustParse(t, input)
+		for _, tc := range [][2]parser.Key{{{"nonesuch"}, nil}, {{"a"}, {"nonesuch"}}} {
+			if err := transform.MoveSection(tc[0], tc[1]).Apply(context.Background(), doc); err == nil {
+				t.Errorf("MoveSection(%q, %q): got nil, want error", tc[0], tc[1])
+			}
+		}
+	})
+}
+
+func TestSetComment(t *testing.T) {
+	const input = `# Old.
+a = 1  # old
+b = {c = 2}
+
+[t]  # tab
+d = 3`
+
+	checkApply(t, input, `# Old.
+a = 1  # migrated
+
+[t]  # tab
+
+# Renamed from e.
+#
+# See notes.
+d = 3`, transform.Plan{
+		{T: transform.SetComment(parser.Key{"a"}, nil, "migrated")},
+		{T: transform.SetComment(parser.Key{"t", "d"}, parser.Comments{"Renamed from e.", "", "# See notes."}, "")},
+		{T: transform.Remove(parser.Key{"b"})},
+	})
+
+	checkApply(t, input, `a = 1  # old
+b = {c = 2}
+
+# About t.
+[t]  # table
+d = 3`, transform.Plan{
+		{T: transform.SetComment(parser.Key{"a"}, parser.Comments{}, "")},
+		{T: transform.SetComment(parser.Key{"t"}, parser.Comments{"About t."}, "table")},
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		doc := mustParse(t, input)
+		for _, key := range []parser.Key{{"nonesuch"}, {"b", "c"}, nil} {
+			if err := transform.SetComment(key, parser.Comments{"x"}, "").Apply(context.Background(), doc); err == nil {
+				t.Errorf("SetComment %q: got nil, want error", key)
+			}
+		}
+	})
+}
+
+func TestUpsertMapping(t *testing.T) {
+	doc := mustParse(t, `[t]
+# About a.
+a = 1  # one
+b = 2  # two
+# End.
+`)
+	tab := doc.Sections[0]
+	upserts := []struct {
+		kv   *parser.KeyValue
+		want bool
+	}{
+		{&parser.KeyValue{Name: parser.Key{"a"}, Value: parser.IntValue(10)}, false},
+		{&parser.KeyValue{Name: parser.Key{"b"}, Value: parser.MustValue("20 # twenty")}, false},
+		{&parser.KeyValue{Block: parser.Comments{"# New."}, Name: parser.Key{"c"}, Value: parser.IntValue(3)}, true},
+		{&parser.KeyValue{Name: parser.Key{"c"}, Value: parser.IntValue(30)}, false},
+	}
+	for _, u := range upserts {
+		if got := transform.UpsertMapping(tab, u.kv); got != u.want {
+			t.Errorf("UpsertMapping %q: got %v, want %v", u.kv.Name, got, u.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tomledit.Format(&buf, doc); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	const want = `[t]
+
+# About a.
+a = 10  # one
+b = 20  # twenty
+
+# New.
+c = 30
+
+# End.
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Result (-want, +got):\n%s", diff)
+	}
+}
+
+func TestInsertMappingAt(t *testing.T) {
+	doc := mustParse(t, `[t]
+a = 1
+c = 3
+# End.
+`)
+	tab := doc.Sections[0]
+	mkv := func(name string, z int64) *parser.KeyValue {
+		return &parser.KeyValue{Name: parser.Key{name}, Value: parser.IntValue(z)}
+	}
+	for _, tc := range []struct {
+		index int
+		kv    *parser.KeyValue
+	}{
+		{1, mkv("b", 2)},
+		{0, mkv("first", 0)},
+		{5, mkv("last", 9)},
+	} {
+		if err := transform.InsertMappingAt(tab, tc.index, tc.kv); err != nil {
+			t.Errorf("InsertMappingAt(%d, %q): unexpected error: %v", tc.index, tc.kv.Name, err)
+		}
+	}
+	for _, tc := range []struct {
+		index int
+		kv    *parser.KeyValue
+	}{
+		{-1, mkv("x", 0)},
+		{7, mkv("x", 0)},
+		{0, mkv("a", 0)},
+	} {
+		if err := transform.InsertMappingAt(tab, tc.index, tc.kv); err == nil {
+			t.Errorf("InsertMappingAt(%d, %q): got nil, want error", tc.index, tc.kv.Name)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tomledit.Format(&buf, doc); err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	const want = `[t]
+first = 0
+a = 1
+b = 2
+c = 3
+
+# End.
+
+last = 9
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Result (-want, +got):\n%s", diff)
+	}
+}
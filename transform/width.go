@@ -0,0 +1,277 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package transform
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/creachadair/tomledit"
+	"github.com/creachadair/tomledit/parser"
+	"github.com/creachadair/tomledit/scanner"
+)
+
+// EnforceLineWidth rewrites doc so that, as far as possible, no line of its
+// output is longer than f.MaxLineWidth bytes when it is formatted by f:
+//
+//   - Long comment lines are wrapped at word boundaries.
+//   - A trailing line comment that makes its line too long is moved to the
+//     end of the block comment of its heading or mapping.
+//   - A long single-line string value is rewritten as a multi-line basic
+//     string with line-ending backslashes, which does not change its content.
+//
+// Long arrays are not rewritten, since f writes them with one element per
+// line, but their elements are checked. Other values, such as inline tables,
+// cannot be wrapped. If any lines remain too long after rewriting,
+// EnforceLineWidth reports an error listing the keys of the mappings
+// responsible. Comments containing words longer than the limit are left long,
+// but are not reported as errors.
+//
+// The check takes into account the Indent and IndentTables settings of f, but
+// not the padding added by AlignValues. It reports an error without modifying
+// doc if f.MaxLineWidth is not positive.
+func EnforceLineWidth(f tomledit.Formatter) Func {
+	return func(_ context.Context, doc *tomledit.Document) error {
+		if f.MaxLineWidth <= 0 {
+			return fmt.Errorf("invalid maximum line width %d", f.MaxLineWidth)
+		}
+		w := lineWidth{max: f.MaxLineWidth, unit: len(f.Indent)}
+		if w.unit == 0 {
+			w.unit = 2 // the default for tomledit.Formatter
+		}
+		var long []string
+		for _, s := range allSections(doc) {
+			var base int // indentation of the section contents
+			if h := s.Heading; h != nil {
+				if h.Trailer != "" && len(h.String())+2+len(parser.CleanTrailer(h.Trailer)) > w.max {
+					h.Block = append(h.Block, h.Trailer)
+					h.Trailer = ""
+				}
+				h.Block = wrapComments(h.Block, 0, w.max)
+				if f.IndentTables {
+					base = w.unit
+				}
+			}
+			for i, item := range s.Items {
+				switch t := item.(type) {
+				case parser.Comments:
+					s.Items[i] = wrapComments(t, base, w.max)
+				case *parser.KeyValue:
+					if !w.fitKeyValue(t, base) {
+						long = append(long, s.TableName().Child(t.Name...).String())
+					}
+				}
+			}
+		}
+		if len(long) != 0 {
+			return fmt.Errorf("lines longer than %d for keys %q", w.max, long)
+		}
+		return nil
+	}
+}
+
+// lineWidth records the layout parameters for EnforceLineWidth.
+type lineWidth struct {
+	max  int // maximum line width in bytes
+	unit int // width of one level of indentation
+}
+
+// fitKeyValue rewrites kv, which is indented by indent columns, to fit within
+// the maximum width, and reports whether it was able to do so.
+func (w lineWidth) fitKeyValue(kv *parser.KeyValue, indent int) bool {
+	col := indent + len(kv.Name.String()) + len(" = ")
+	if tr := kv.Value.Trailer; tr != "" && !w.isWrapped(kv.Value.X, col) {
+		if col+len(kv.Value.X.String())+2+len(parser.CleanTrailer(tr)) > w.max {
+			kv.Block = append(kv.Block, tr)
+			kv.Value.Trailer = ""
+		}
+	}
+	kv.Block = wrapComments(kv.Block, indent, w.max)
+
+	if tok, ok := kv.Value.X.(parser.Token); ok && col+len(tok.String()) > w.max {
+		if nv, ok := wrapString(tok, col, w.max); ok {
+			kv.Value.X = nv
+		}
+	}
+	return w.datumFits(kv.Value.X, col, indent)
+}
+
+// isWrapped reports whether d, formatted starting at column col, is written
+// on more than one line, either because of its contents or because it is an
+// array too long to fit on one line.
+func (w lineWidth) isWrapped(d parser.Datum, col int) bool {
+	if isMultilineDatum(d) {
+		return true
+	}
+	a, ok := d.(parser.Array)
+	return ok && len(a) != 0 && col+len(a.String()) > w.max
+}
+
+// datumFits reports whether d fits in the maximum width when formatted
+// starting at column col, where indent is the indentation of the enclosing
+// line.  Block comments inside multi-line arrays are wrapped as a side effect.
+func (w lineWidth) datumFits(d parser.Datum, col, indent int) bool {
+	switch t := d.(type) {
+	case parser.Token:
+		lines := strings.Split(t.String(), "\n")
+		if col+len(lines[0]) > w.max {
+			return false
+		}
+		for _, line := range lines[1:] {
+			if len(line) > w.max {
+				return false
+			}
+		}
+		return true
+
+	case parser.Array:
+		if !w.isWrapped(t, col) {
+			return true
+		}
+		ok := true
+		inner := indent + w.unit
+		for i, elt := range t {
+			switch e := elt.(type) {
+			case parser.Comments:
+				t[i] = wrapComments(e, inner, w.max)
+			case parser.Value:
+				if !w.datumFits(e.X, inner, inner) {
+					ok = false
+				}
+			}
+		}
+		return ok
+	}
+	return col+len(d.String()) <= w.max
+}
+
+// isMultilineDatum reports whether the formatter will render d on more than
+// one line. This must agree with the layout rules of tomledit.Formatter.
+func isMultilineDatum(d parser.Datum) bool {
+	switch t := d.(type) {
+	case parser.Token:
+		return t.Type == scanner.MString || t.Type == scanner.MLString
+	case parser.Array:
+		for _, elt := range t {
+			switch e := elt.(type) {
+			case parser.Value:
+				if e.Trailer != "" || isMultilineDatum(e.X) {
+					return true
+				}
+				if in, ok := e.X.(parser.Inline); ok && len(in) != 0 {
+					return true
+				}
+				if a, ok := e.X.(parser.Array); ok && len(a) != 0 {
+					return true
+				}
+			case parser.Comments:
+				if len(e) != 0 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// wrapComments returns a copy of c with each line wrapped at word boundaries
+// so that, when indented by indent columns, it fits within max columns.
+func wrapComments(c parser.Comments, indent, max int) parser.Comments {
+	if len(c) == 0 {
+		return c
+	}
+	var out parser.Comments
+	for _, line := range c.Clean() {
+		if indent+len(line) <= max {
+			out = append(out, line)
+			continue
+		}
+		// Preserve the marker and any indentation following it.
+		text := strings.TrimLeft(line[1:], " ")
+		mark := line[:len(line)-len(text)]
+		out = append(out, wrapWords(strings.Fields(text), max-indent-len(mark), mark)...)
+	}
+	return out
+}
+
+// wrapWords greedily packs words into lines no longer than width (except for
+// single words that are longer), each prefixed by mark.
+func wrapWords(words []string, width int, mark string) []string {
+	var lines []string
+	var cur string
+	for _, w := range words {
+		if cur == "" {
+			cur = w
+		} else if len(cur)+1+len(w) <= width {
+			cur += " " + w
+		} else {
+			lines = append(lines, mark+cur)
+			cur = w
+		}
+	}
+	return append(lines, mark+cur)
+}
+
+// wrapString rewrites a single-line string token as a multi-line basic string
+// whose first line begins at column col, and whose lines fit within max
+// columns. It reports false if tok is not a single-line string, or if the
+// string cannot be broken into lines that fit.
+//
+// Lines are broken after a space that is followed by a non-space, and each
+// line but the last ends with a backslash, which elides the line break.
+func wrapString(tok parser.Token, col, max int) (parser.Datum, bool) {
+	if tok.Type != scanner.String && tok.Type != scanner.LString {
+		return nil, false
+	}
+	content, err := tok.Unquote()
+	if err != nil {
+		return nil, false
+	}
+
+	// Split content into chunks that each end after a space followed by a
+	// non-space, since a line-ending backslash consumes leading whitespace on
+	// the next line.
+	var chunks []string
+	start := 0
+	for i := 1; i < len(content); i++ {
+		if content[i-1] == ' ' && content[i] != ' ' {
+			chunks = append(chunks, content[start:i])
+			start = i
+		}
+	}
+	chunks = append(chunks, content[start:])
+
+	// Pack escaped chunks into lines, leaving room for the quotes on the first
+	// and last lines and the backslash at the end of each line but the last.
+	var lines []string
+	var cur string
+	width := max - col - len(`"""`)
+	for _, c := range chunks {
+		esc := string(scanner.Escape(c))
+		if cur != "" && len(cur)+len(esc)+len(`"""`) > width {
+			lines = append(lines, cur)
+			cur = ""
+			width = max
+		}
+		cur += esc
+	}
+	lines = append(lines, cur)
+	for i, line := range lines {
+		limit := max - 1 // room for "\" or one of the closing quotes
+		if i == 0 {
+			limit -= col + len(`"""`)
+		}
+		if i == len(lines)-1 {
+			limit -= len(`""`)
+		}
+		if len(line) > limit {
+			return nil, false
+		}
+	}
+	v, err := parser.ParseValue(`"""` + strings.Join(lines, "\\\n") + `"""`)
+	if err != nil {
+		return nil, false
+	}
+	return v.X, true
+}
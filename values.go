@@ -0,0 +1,98 @@
+// Copyright (C) 2026 Michael J. Fromberger. All Rights Reserved.
+
+package tomledit
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/creachadair/tomledit/parser"
+)
+
+// EachValue calls fn for each value in d, in order of occurrence, and returns
+// the number of values replaced.  The arguments to fn are the complete key of
+// the mapping containing the value and the value itself. If fn returns a new
+// value and true, the new value replaces the original in d.
+//
+// Array elements and the values of inline table entries are also visited,
+// after the array or table that contains them. For an array element, the key
+// is that of the array. If fn replaces an array or inline table, the contents
+// of the replacement are not visited.
+func (d *Document) EachValue(fn func(key parser.Key, v parser.Value) (parser.Value, bool)) int {
+	var n int
+	visit := func(s *Section) {
+		if s == nil {
+			return
+		}
+		for _, item := range s.Items {
+			if kv, ok := item.(*parser.KeyValue); ok {
+				key := append(append(parser.Key(nil), s.TableName()...), kv.Name...)
+				n += eachValue(key, &kv.Value, fn)
+			}
+		}
+	}
+	visit(d.Global)
+	for _, s := range d.Sections {
+		visit(s)
+	}
+	return n
+}
+
+// eachValue calls fn for v and its contents, and returns the number of values
+// replaced.
+func eachValue(key parser.Key, v *parser.Value, fn func(parser.Key, parser.Value) (parser.Value, bool)) int {
+	if nv, ok := fn(key, *v); ok {
+		*v = nv
+		return 1
+	}
+	var n int
+	switch t := v.X.(type) {
+	case parser.Array:
+		for i, elt := range t {
+			if ev, ok := elt.(parser.Value); ok {
+				n += eachValue(key, &ev, fn)
+				t[i] = ev
+			}
+		}
+	case parser.Inline:
+		for _, kv := range t {
+			sub := append(append(parser.Key(nil), key...), kv.Name...)
+			n += eachValue(sub, &kv.Value, fn)
+		}
+	}
+	return n
+}
+
+// Duration returns the duration denoted by the value of a mapping entry, which
+// must be a string in the format accepted by time.ParseDuration, such as "30s"
+// or "1h15m". It reports an error if e is not a mapping, or if its value is not
+// a string or is not a valid duration. Use parser.DurationValue to construct a
+// value representing a duration.
+func (e *Entry) Duration() (time.Duration, error) {
+	if e == nil || !e.IsMapping() {
+		return 0, errors.New("entry is not a mapping")
+	}
+	tok, _ := e.Value.X.(parser.Token)
+	s, err := tok.Unquote()
+	if err != nil {
+		return 0, fmt.Errorf("value of %q is not a string", e.Name)
+	}
+	return time.ParseDuration(s)
+}
+
+// Bytes returns the binary data encoded by the value of a mapping entry, which
+// must be a string encoded with enc. It reports an error if e is not a mapping,
+// or if its value is not a string or is not validly encoded. Use
+// parser.BytesValue to construct a value representing binary data.
+func (e *Entry) Bytes(enc parser.Encoding) ([]byte, error) {
+	if e == nil || !e.IsMapping() {
+		return nil, errors.New("entry is not a mapping")
+	}
+	tok, _ := e.Value.X.(parser.Token)
+	s, err := tok.Unquote()
+	if err != nil {
+		return nil, fmt.Errorf("value of %q is not a string", e.Name)
+	}
+	return enc.Decode(s)
+}